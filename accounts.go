@@ -0,0 +1,14 @@
+package accounting_bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+func FormatAccounts(accounts []*Account) string {
+	b := strings.Builder{}
+	for _, account := range accounts {
+		b.WriteString(fmt.Sprintf("$%s — %.2f%s\n", account.Name, account.Balance, account.Currency))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
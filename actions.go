@@ -0,0 +1,163 @@
+package accounting_bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"golang.org/x/text/currency"
+)
+
+const frequentTagsLimit = 6
+
+var (
+	// days before today offered by "Change date" button
+	quickDates = []int{0, 1, 2, 3, 7}
+	// currencies offered by "Change currency" button besides user's one
+	quickCurrencies = []string{"USD", "EUR", "RUB", "GBP"}
+)
+
+// EntryReplyText describes saved entry in bot reply
+func EntryReplyText(entry *Entry) string {
+	// TODO: i18n
+	text := fmt.Sprintf("Added %.2f%s", entry.Value, entry.Currency)
+	if entry.Expression != "" {
+		text += " = " + entry.Expression
+	}
+	if entry.CreatedAt.Format("2006-01-02") != time.Now().Format("2006-01-02") {
+		text += " on " + entry.CreatedAt.Format("2006-01-02")
+	}
+	if len(entry.Tags) > 0 {
+		text += "\n" + strings.Join(entry.Tags, " ")
+	}
+	return text
+}
+
+// entryKeyboard returns main menu of actions on entry
+func entryKeyboard(entry *Entry) tgbotapi.InlineKeyboardMarkup {
+	// TODO: i18n
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Delete", EncodeCallback(callbackEntryDelete, entry.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("Change date", EncodeCallback(callbackEntryDate, entry.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Add tag", EncodeCallback(callbackEntryTag, entry.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("Change currency", EncodeCallback(callbackEntryCurrency, entry.ID)),
+		),
+	)
+}
+
+// entrySubmenu returns keyboard with options of action and button to return back to main menu
+func entrySubmenu(entry *Entry, action string, options [][2]string) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(options)+1)
+	for _, option := range options {
+		data := EncodeCallback(action, entry.ID, option[1])
+		if !ValidCallback(data) {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(option[0], data)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("« Back", EncodeCallback(callbackEntryMenu, entry.ID)), // TODO: i18n
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleEntryCallback handles buttons of "Added" reply, action without option opens submenu of action
+func (b *Bot) handleEntryCallback(
+	ctx context.Context, user *User, msg *tgbotapi.Message, action, id string, args []string,
+) error {
+	entry, err := b.storage.GetEntry(ctx, user, id)
+	if err != nil {
+		return b.handleError(msg.Chat.ID, err)
+	}
+
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	switch {
+	case action == callbackEntryDelete:
+		if err := b.storage.DeleteEntry(ctx, user, entry.ID); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, err := b.send(tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, "Deleted")) // TODO: i18n
+		if err != nil && !isNotModifiedError(err) {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		return nil
+	case action == callbackEntryMenu:
+		keyboard = entryKeyboard(entry)
+	case action == callbackEntryDate && len(args) == 0:
+		options := make([][2]string, 0, len(quickDates))
+		for _, days := range quickDates {
+			// TODO: i18n
+			title := fmt.Sprintf("%d days ago", days)
+			switch days {
+			case 0:
+				title = "Today"
+			case 1:
+				title = "Yesterday"
+			}
+			options = append(options, [2]string{title, strconv.Itoa(days)})
+		}
+		keyboard = entrySubmenu(entry, action, options)
+	case action == callbackEntryDate:
+		days, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil
+		}
+		// keep time of day, only date is changed
+		now := time.Now().In(entry.CreatedAt.Location()).AddDate(0, 0, -days)
+		entry.CreatedAt = time.Date(
+			now.Year(), now.Month(), now.Day(),
+			entry.CreatedAt.Hour(), entry.CreatedAt.Minute(), entry.CreatedAt.Second(), 0,
+			entry.CreatedAt.Location(),
+		)
+		keyboard = entryKeyboard(entry)
+	case action == callbackEntryTag && len(args) == 0:
+		tags, err := b.storage.FrequentTags(ctx, user, frequentTagsLimit)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		options := make([][2]string, 0, len(tags))
+		for _, tag := range tags {
+			if !containsString(entry.Tags, tag) {
+				options = append(options, [2]string{tag, tag})
+			}
+		}
+		keyboard = entrySubmenu(entry, action, options)
+	case action == callbackEntryTag:
+		if !containsString(entry.Tags, args[0]) {
+			entry.Tags = append(entry.Tags, args[0])
+		}
+		keyboard = entryKeyboard(entry)
+	case action == callbackEntryCurrency && len(args) == 0:
+		options := [][2]string{{user.Currency, user.Currency}}
+		for _, code := range quickCurrencies {
+			if code != user.Currency {
+				options = append(options, [2]string{code, code})
+			}
+		}
+		keyboard = entrySubmenu(entry, action, options)
+	case action == callbackEntryCurrency:
+		if _, err := currency.ParseISO(args[0]); err != nil {
+			return b.handleError(msg.Chat.ID, &InvalidCurrencyError{Currency: args[0]})
+		}
+		entry.Currency = args[0]
+		keyboard = entryKeyboard(entry)
+	}
+
+	if len(args) > 0 {
+		if entry, err = b.storage.UpdateEntry(ctx, user, entry); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+	}
+	edit := tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, EntryReplyText(entry))
+	edit.ReplyMarkup = &keyboard
+	if _, err := b.send(edit); err != nil && !isNotModifiedError(err) {
+		return b.handleError(msg.Chat.ID, err)
+	}
+	return nil
+}
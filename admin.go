@@ -0,0 +1,126 @@
+package accounting_bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	adminUsersLimit = 50
+	// users with entries changed during this period are counted as active
+	adminActivePeriod = 30 * 24 * time.Hour
+	// telegram allows about 30 messages per second
+	broadcastInterval = 50 * time.Millisecond
+)
+
+func (b *Bot) isAdmin(telegramID int64) bool {
+	for _, id := range b.config.Admins {
+		if id == telegramID {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatUsers returns list of users with their activity
+func FormatUsers(users []*UserSummary) string {
+	// TODO: i18n
+	if len(users) == 0 {
+		return "No users yet"
+	}
+	b := strings.Builder{}
+	for i, item := range users {
+		if i == adminUsersLimit {
+			b.WriteString(fmt.Sprintf("… and %d more", len(users)-adminUsersLimit))
+			break
+		}
+		status := "enabled"
+		if !item.User.Enabled {
+			status = "disabled"
+		}
+		b.WriteString(fmt.Sprintf(
+			"%d %s, %s, entries: %d, last: %s\n",
+			item.User.TelegramID, status, item.User.Currency, item.Entries, item.LastEntryAt.Format("2006-01-02"),
+		))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// FormatStats returns usage of bot
+func FormatStats(stats *Stats) string {
+	// TODO: i18n
+	return fmt.Sprintf(
+		"Users: %d, enabled: %d\nActive last %d days: %d\nEntries: %d",
+		stats.Users, stats.EnabledUsers, int(adminActivePeriod.Hours()/24), stats.ActiveUsers, stats.Entries,
+	)
+}
+
+func (b *Bot) handleAdmin(ctx context.Context, msg *tgbotapi.Message, cmd *AdminCommand) error {
+	// command is hidden from everyone else
+	if msg.From == nil || !b.isAdmin(int64(msg.From.ID)) {
+		return b.handleError(msg.Chat.ID, &UnknownCommandError{Command: "/admin"})
+	}
+	switch cmd.Action {
+	case "users":
+		users, err := b.storage.ListUsers(ctx)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, FormatUsers(users)))
+	case "stats":
+		stats, err := b.storage.GetStats(ctx, time.Now().Add(-adminActivePeriod))
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, FormatStats(stats)))
+	case "enable", "disable":
+		ok, err := b.storage.SetUserEnabled(ctx, cmd.TelegramID, cmd.Action == "enable")
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		text := fmt.Sprintf("User %d is %sd", cmd.TelegramID, cmd.Action) // TODO: i18n
+		if !ok {
+			text = fmt.Sprintf("User %d not found", cmd.TelegramID) // TODO: i18n
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, text))
+	case "broadcast":
+		ids, err := b.storage.ListEnabledUserIDs(ctx)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Broadcast started")) // TODO: i18n
+		// sending to every user takes much longer than handling of usual message
+		b.goBackground(ctx, func(ctx context.Context) {
+			b.broadcast(ctx, msg.Chat.ID, ids, cmd.Text)
+		})
+	}
+	return nil
+}
+
+// broadcast sends text to users and reports result to admin, it stops when bot stops
+func (b *Bot) broadcast(ctx context.Context, adminChatID int64, telegramIDs []int64, text string) {
+	sent, failed := 0, 0
+	status := "finished"
+loop:
+	for _, id := range telegramIDs {
+		if _, err := b.send(tgbotapi.NewMessage(id, text)); err != nil {
+			b.log(ctx).WithError(err).WithField("telegram_id", id).Warn("failed to broadcast")
+			failed++
+		} else {
+			sent++
+		}
+		select {
+		case <-ctx.Done():
+			status = "interrupted"
+			break loop
+		case <-time.After(broadcastInterval):
+		}
+	}
+	_, _ = b.send(tgbotapi.NewMessage(
+		adminChatID, fmt.Sprintf("Broadcast %s, sent: %d, failed: %d", status, sent, failed), // TODO: i18n
+	))
+}
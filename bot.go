@@ -2,19 +2,37 @@ package accounting_bot
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
-const VERSION = 1
+const VERSION = 2
+
+const (
+	findPageSize     = 10
+	lastDefaultLimit = 10
+	lastMaxLimit     = 50
+)
 
 type Config struct {
 	AuthCode     string
 	AdminContact string
+	// Admins are telegram ids of users allowed to use /admin commands
+	Admins []int64
+	// InviteOnly requires invite code to start using bot even if AuthCode is not set
+	InviteOnly bool
+	// RateLimits by class of commands, every message is limited by default class, heavy commands by both
+	RateLimits map[string]RateLimit
 }
 
 type Bot struct {
@@ -23,26 +41,46 @@ type Bot struct {
 	api     *tgbotapi.BotAPI
 	storage Repository
 	config  Config
+	imports importsQueue
+	limiter *rateLimiter
 	stopC   chan struct{}
 	doneC   chan struct{}
+	// startedC is closed when bot has connected to telegram
+	startedC chan struct{}
+	// background tasks outlive handling of update, they are cancelled and waited for when bot stops
+	backgroundCtx    context.Context
+	cancelBackground context.CancelFunc
+	background       sync.WaitGroup
+	telegram         telegramHealth
+	metrics          *botMetrics
 }
 
 func (b *Bot) handleError(chatID int64, err error) error {
+	b.metrics.errors.WithLabelValues(errorType(err)).Inc()
 	if err, ok := err.(fmt.Stringer); ok {
-		_, _ = b.api.Send(tgbotapi.NewMessage(chatID, err.String())) // TODO: i18n
+		_, _ = b.send(tgbotapi.NewMessage(chatID, err.String())) // TODO: i18n
 		return nil
 	}
 	if _, ok := err.(*UnknownCommandError); !ok {
-		_, _ = b.api.Send(tgbotapi.NewMessage(chatID, "sorry, internal error :(")) // TODO: i18n
+		_, _ = b.send(tgbotapi.NewMessage(chatID, "sorry, internal error :(")) // TODO: i18n
 		return err
 	}
 	return nil
 }
 
-func (b *Bot) handle(update *tgbotapi.Update) error {
+func (b *Bot) handle(ctx context.Context, update *tgbotapi.Update) error {
+	started := time.Now()
+	command := "unknown"
+	defer func() {
+		b.metrics.observeUpdate(command, started)
+	}()
+
 	var msg *tgbotapi.Message
 	updated := false
-	if update.Message != nil {
+	if update.CallbackQuery != nil {
+		command = "callback"
+		return b.handleCallback(ctx, update.CallbackQuery)
+	} else if update.Message != nil {
 		msg = update.Message
 	} else if update.EditedMessage != nil {
 		msg = update.EditedMessage
@@ -53,44 +91,85 @@ func (b *Bot) handle(update *tgbotapi.Update) error {
 	if msg.Chat == nil {
 		return nil
 	}
-	b.logger.WithFields(logrus.Fields{
-		"id":   msg.MessageID,
-		"text": msg.Text,
-	}).Debug("handle message")
+	fields := logrus.Fields{"chat_id": msg.Chat.ID, "message_id": msg.MessageID}
+	if msg.From != nil {
+		fields["user_id"] = msg.From.ID
+	}
+	ctx = ContextWithLogger(ctx, b.log(ctx).WithFields(fields))
+	b.log(ctx).WithField("edited", updated).Debug("handle message")
 
+	// with privacy mode disabled bot receives every message of group chat, other messages than commands
+	// are answered only when they are entries of ledger members
+	quiet := isGroupChat(msg.Chat) && commandName(msg.Text) == ""
 	cmd, err := ParseCommand(msg)
+	// chatter of group does not count towards rate limit, only messages which look like entries do
+	if _, ok := err.(*UnknownCommandError); ok && quiet {
+		command = "ignored"
+		return nil
+	}
+	if !b.allow(ctx, msg.Chat.ID, msg.From, RateClassDefault, quiet) {
+		return nil
+	}
 	if err != nil {
+		command = "invalid"
+		// usage of admin commands is hidden from everyone else
+		if err, ok := err.(*InvalidSyntaxError); ok {
+			if spec := commandsByName[err.Command]; spec != nil && spec.Admin &&
+				(msg.From == nil || !b.isAdmin(int64(msg.From.ID))) {
+				return b.handleError(msg.Chat.ID, &UnknownCommandError{Command: err.Command})
+			}
+		}
 		return b.handleError(msg.Chat.ID, err)
 	}
+	command = commandType(cmd)
+	if class := commandClass(cmd); class != RateClassDefault && !b.allow(ctx, msg.Chat.ID, msg.From, class, quiet) {
+		return nil
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	user, err := b.storage.GetUserByTelegramID(ctx, msg.Chat.ID)
 	if err != nil {
 		return b.handleError(msg.Chat.ID, err)
 	}
-	// TODO: check bot version and send changelog to user
+	// admins may have no ledger of their own
+	switch cmd := cmd.(type) {
+	case *AdminCommand:
+		return b.handleAdmin(ctx, msg, cmd)
+	case *InviteCommand:
+		return b.handleInvite(ctx, msg, cmd)
+	}
 
 	switch cmd.(type) {
 	case *HelpCommand:
-		_, _ = b.api.Send(Markdown(tgbotapi.NewMessage(msg.Chat.ID, manual)))
+		text := manual
+		if name := cmd.(*HelpCommand).Command; name != "" {
+			text = FormatCommandHelp(commandsByName[name])
+		}
+		_, _ = b.send(Markdown(tgbotapi.NewMessage(msg.Chat.ID, text)))
 		return nil
 	case *StartCommand:
 		if user == nil {
-			cmd := cmd.(*StartCommand)
-			if b.config.AuthCode != "" && cmd.Code != b.config.AuthCode {
-				return b.handleError(msg.Chat.ID, &InvalidAuthCodeError{})
+			invite, err := b.inviteCode(cmd.(*StartCommand).Code)
+			if err != nil {
+				return b.handleError(msg.Chat.ID, err)
+			}
+			// creator of shared ledger joins it at once
+			var member *Member
+			if isGroupChat(msg.Chat) && msg.From != nil {
+				member = newMember(msg.From)
 			}
-			user, err = b.storage.SaveUser(ctx, &User{
+			user, err = b.storage.CreateUser(ctx, &User{
 				TelegramID: msg.Chat.ID,
+				BotVersion: VERSION,
 				Enabled:    true,
 				Currency:   "USD",
 				Features:   Features{},
-			})
+			}, member, invite)
 			if err != nil {
 				return b.handleError(msg.Chat.ID, err)
 			}
-			_, _ = b.api.Send(
+			_, _ = b.send(
 				// TODO: i18n
 				Markdown(tgbotapi.NewMessage(
 					msg.Chat.ID,
@@ -102,7 +181,22 @@ func (b *Bot) handle(update *tgbotapi.Update) error {
 	}
 
 	if user == nil || !user.Enabled {
-		return b.handleError(msg.Chat.ID, &UserNotFoundError{})
+		if quiet {
+			return nil
+		}
+		return b.handleError(msg.Chat.ID, &UserNotFoundError{AdminContact: b.config.AdminContact})
+	}
+	if user.BotVersion < VERSION {
+		b.sendChangelog(ctx, user)
+	}
+	if _, ok := cmd.(*JoinCommand); ok {
+		return b.join(ctx, user, msg)
+	}
+	if err := b.checkMember(ctx, user, msg.Chat, msg.From); err != nil {
+		if _, ok := err.(*NotMemberError); ok && quiet {
+			return nil
+		}
+		return b.handleError(msg.Chat.ID, err)
 	}
 	// TODO: split into separate methods
 	switch cmd := cmd.(type) {
@@ -112,44 +206,227 @@ func (b *Bot) handle(update *tgbotapi.Update) error {
 		if err != nil {
 			return b.handleError(msg.Chat.ID, err)
 		}
-		_, _ = b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Saved")) // TODO: i18n
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Saved")) // TODO: i18n
 	case *DumpCommand:
 		// TODO: possible danger operation, on huge list of entries can cause oom and lots of gc time
 		items, err := b.storage.GetAllEntries(ctx, user, cmd.From, cmd.Tags)
 		if err != nil {
 			return b.handleError(msg.Chat.ID, err)
 		}
-		//_ = items
-		//for _, item := range items {
-		//	b.logger.WithField("item", item).Debug("dump")
-		//}
-		//b.logger.WithField("len", len(items)).Debug("items")
-		//b.logger.WithField("cmd", cmd).Debug("cmd")
-		rdr, err := DumpCsv(items)
+		format, ok := dumpFormats[cmd.Format]
+		if !ok {
+			return b.handleError(msg.Chat.ID, &InvalidDumpFormatError{Format: cmd.Format})
+		}
+		rdr, err := format.Dump(items, DumpOptions{Accounts: user.Features.Accounts})
 		if err != nil {
 			return b.handleError(msg.Chat.ID, err)
 		}
 		defer rdr.Close()
 		doc := tgbotapi.NewDocumentUpload(msg.Chat.ID, tgbotapi.FileReader{
-			Name:   time.Now().Format("20060102_150405") + ".csv",
+			Name:   time.Now().Format("20060102_150405") + "." + format.Extension,
 			Reader: rdr,
 			Size:   -1,
 		})
-		_, err = b.api.Send(doc)
+		_, err = b.send(doc)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+	case *FindCommand:
+		text, keyboard, entries, err := b.findEntriesPage(ctx, user, cmd, (cmd.Page-1)*findPageSize)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		reply := Markdown(tgbotapi.NewMessage(msg.Chat.ID, text))
+		if keyboard != nil {
+			reply.ReplyMarkup = keyboard
+		}
+		_, _ = b.send(reply)
+		b.replyEntries(msg.Chat.ID, entries)
+	case *LastCommand:
+		text, keyboard, err := b.lastEntriesPage(ctx, user, cmd.Tags, 0, cmd.Limit)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		reply := Markdown(tgbotapi.NewMessage(msg.Chat.ID, text))
+		if keyboard != nil {
+			reply.ReplyMarkup = keyboard
+		}
+		_, _ = b.send(reply)
+	case *ChartCommand:
+		img, caption, err := b.renderChart(ctx, user, cmd)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		photo := tgbotapi.NewPhotoUpload(msg.Chat.ID, tgbotapi.FileBytes{Name: "chart.png", Bytes: img})
+		photo.Caption = caption
+		if _, err := b.send(photo); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+	case *ReportCommand:
+		user.Features.Report = cmd.Period
+		// reports for periods passed before subscription are not sent
+		user.Features.ReportSentAt = time.Now()
+		if _, err := b.storage.SaveUser(ctx, user); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		// TODO: i18n
+		text := fmt.Sprintf("You will receive %s reports", cmd.Period)
+		if cmd.Period == "" {
+			text = "Reports disabled"
+		} else if user.Features.Timezone == "" {
+			text += "\nTo receive them in your local time send `/timezone Europe/Moscow`"
+		}
+		_, _ = b.send(Markdown(tgbotapi.NewMessage(msg.Chat.ID, text)))
+	case *TimezoneCommand:
+		user.Features.Timezone = cmd.Timezone
+		if _, err := b.storage.SaveUser(ctx, user); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Saved")) // TODO: i18n
+	case *MembersCommand:
+		members, err := b.storage.SumByMembers(ctx, user, cmd.From)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Members:\n"+FormatMembers(members))) // TODO: i18n
+	case *DebtsCommand:
+		if !isGroupChat(msg.Chat) {
+			return b.handleError(msg.Chat.ID, &NotGroupChatError{})
+		}
+		balances, err := b.storage.GetBalances(ctx, user)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		transfers := SettleDebts(balances)
+		if len(transfers) == 0 {
+			_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "No debts")) // TODO: i18n
+			return nil
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Debts:\n"+FormatTransfers(transfers))) // TODO: i18n
+	case *SettleCommand:
+		if !isGroupChat(msg.Chat) || msg.From == nil {
+			return b.handleError(msg.Chat.ID, &NotGroupChatError{})
+		}
+		to, err := b.findMembers(ctx, user, []string{cmd.Name}, nil)
 		if err != nil {
 			return b.handleError(msg.Chat.ID, err)
 		}
+		if to[0] == int64(msg.From.ID) {
+			return b.handleError(msg.Chat.ID, &SelfSettlementError{})
+		}
+		if err := b.storage.SaveSettlement(
+			ctx, user, int64(msg.From.ID), to[0], cmd.Value, user.Currency,
+		); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		// TODO: i18n
+		_, _ = b.send(tgbotapi.NewMessage(
+			msg.Chat.ID, fmt.Sprintf("Payment of %.2f%s to @%s recorded", cmd.Value, user.Currency, cmd.Name),
+		))
+	case *AddAccountCommand:
+		account, err := b.storage.SaveAccount(ctx, user, &cmd.Account)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		if cmd.Value > 0 {
+			if err := b.storage.SaveTransfer(ctx, user, nil, account, cmd.Value); err != nil {
+				return b.handleError(msg.Chat.ID, err)
+			}
+		}
+		// TODO: i18n
+		_, _ = b.send(Markdown(tgbotapi.NewMessage(
+			msg.Chat.ID,
+			fmt.Sprintf("Account %s added\nTo use it add `$%s` to entry", account.Name, account.Name),
+		)))
+	case *ListAccountsCommand:
+		accounts, err := b.storage.ListAccounts(ctx, user)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Accounts:\n"+FormatAccounts(accounts))) // TODO: i18n
+	case *TransferCommand:
+		from, err := b.storage.GetAccount(ctx, user, cmd.From)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		to, err := b.storage.GetAccount(ctx, user, cmd.To)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		if from.Currency != to.Currency {
+			return b.handleError(msg.Chat.ID, &CurrencyMismatchError{})
+		}
+		if err := b.storage.SaveTransfer(ctx, user, from, to, cmd.Value); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Saved")) // TODO: i18n
+	case *MapAccountCommand:
+		if user.Features.Accounts == nil {
+			user.Features.Accounts = make(map[string]string)
+		}
+		if cmd.Account == "" {
+			delete(user.Features.Accounts, cmd.Tag)
+		} else {
+			user.Features.Accounts[cmd.Tag] = cmd.Account
+		}
+		if _, err := b.storage.SaveUser(ctx, user); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Saved")) // TODO: i18n
+	case *ListMapAccountsCommand:
+		tags := make([]string, 0, len(user.Features.Accounts))
+		for tag := range user.Features.Accounts {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		lines := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			lines = append(lines, tag+" → "+user.Features.Accounts[tag])
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Accounts:\n"+strings.Join(lines, "\n"))) // TODO: i18n
+	case *ImportCommand:
+		return b.handleImport(ctx, user, msg, cmd)
 	case *EntryCommand:
+		rules, err := b.storage.ListRules(ctx, user)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		cmd.Entry.Tags = ApplyRules(rules, cmd.Entry.Comment, cmd.Entry.Tags)
+		// in private chat mentions are just a part of comment
+		var debtors []int64
+		if isGroupChat(msg.Chat) {
+			debtors, err = b.findMembers(ctx, user, cmd.Split, cmd.SplitIDs)
+			if err != nil {
+				return b.handleError(msg.Chat.ID, err)
+			}
+		}
+		if cmd.Entry.Account != "" {
+			account, err := b.storage.GetAccount(ctx, user, cmd.Entry.Account)
+			if err != nil {
+				return b.handleError(msg.Chat.ID, err)
+			}
+			cmd.Entry.AccountID = account.ID
+			cmd.Entry.Currency = account.Currency
+		}
 		entry, err := b.storage.SaveEntry(ctx, user, &cmd.Entry)
+		if _, ok := err.(*EntryNotFoundError); ok && updated {
+			// message of deleted entry was edited
+			return nil
+		}
 		if err != nil {
 			return b.handleError(msg.Chat.ID, err)
 		}
-		if !updated {
-			// TODO: i18n
-			addedMsg, err := b.api.Send(tgbotapi.NewMessage(
-				msg.Chat.ID,
-				fmt.Sprintf("Added %.2f%s", entry.Value, entry.Currency)),
-			)
+		// entry could be edited and mentions removed, so split is saved even when it's empty
+		if isGroupChat(msg.Chat) {
+			if err := b.storage.SaveSplit(ctx, user, entry, entry.AuthorID, debtors); err != nil {
+				return b.handleError(msg.Chat.ID, err)
+			}
+		}
+		// reply could be not saved if sending of it failed
+		if !updated || entry.ReplyID == 0 {
+			reply := tgbotapi.NewMessage(msg.Chat.ID, EntryReplyText(entry))
+			reply.ReplyMarkup = entryKeyboard(entry)
+			addedMsg, err := b.send(reply)
 			if err != nil {
 				return b.handleError(msg.Chat.ID, err)
 			}
@@ -158,18 +435,10 @@ func (b *Bot) handle(update *tgbotapi.Update) error {
 				return b.handleError(msg.Chat.ID, err)
 			}
 		} else {
-			// TODO: i18n
-			_, err := b.api.Send(tgbotapi.NewEditMessageText(
-				msg.Chat.ID,
-				int(entry.ReplyID),
-				fmt.Sprintf("Added %.2f%s", entry.Value, entry.Currency),
-			))
-			if err != nil && !strings.Contains(
-				// we should not send error back in this special case
-				// only way to handle this error is compare text description
-				err.Error(),
-				"specified new message content and reply markup are exactly the same as a current content and reply markup of the message",
-			) {
+			edit := tgbotapi.NewEditMessageText(msg.Chat.ID, int(entry.ReplyID), EntryReplyText(entry))
+			keyboard := entryKeyboard(entry)
+			edit.ReplyMarkup = &keyboard
+			if _, err := b.send(edit); err != nil && !isNotModifiedError(err) {
 				return b.handleError(msg.Chat.ID, err)
 			}
 		}
@@ -177,23 +446,265 @@ func (b *Bot) handle(update *tgbotapi.Update) error {
 		if err := b.storage.AddTag(ctx, user, cmd.SearchTag, cmd.Tags); err != nil {
 			return b.handleError(msg.Chat.ID, err)
 		}
-		_, _ = b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Tags added")) // TODO: i18n
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Tags added")) // TODO: i18n
 	case *RemoveTagCommand:
 		if err := b.storage.RemoveTag(ctx, user, cmd.Tags); err != nil {
 			return b.handleError(msg.Chat.ID, err)
 		}
-		_, _ = b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Tags removed")) // TODO: i18n
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Tags removed")) // TODO: i18n
+	case *MergeTagsCommand:
+		if err := b.storage.MergeTags(ctx, user, cmd.Tags, cmd.Into); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Tags merged into "+cmd.Into)) // TODO: i18n
+	case *AddRuleCommand:
+		rule, err := b.storage.SaveRule(ctx, user, &cmd.Rule)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		// TODO: i18n
+		_, _ = b.send(Markdown(tgbotapi.NewMessage(
+			msg.Chat.ID,
+			fmt.Sprintf("Rule %s added\nTo apply it to existing entries send `/rule apply %s`", rule.ID, rule.ID),
+		)))
+	case *DeleteRuleCommand:
+		if err := b.storage.DeleteRule(ctx, user, cmd.ID); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Rule deleted")) // TODO: i18n
+	case *ApplyRuleCommand:
+		n, err := b.storage.ApplyRule(ctx, user, cmd.ID)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Entries updated: %d", n))) // TODO: i18n
+	case *ListRulesCommand:
+		rules, err := b.storage.ListRules(ctx, user)
+		if err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Rules:\n"+FormatRules(rules))) // TODO: i18n
 	case *ListTagsCommand:
 		tags, err := b.storage.ListTag(ctx, user, cmd.SearchTags)
 		if err != nil {
 			return b.handleError(msg.Chat.ID, err)
 		}
-		_, _ = b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Tags:\n"+strings.Join(tags, "\n"))) // TODO: i18n
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Tags:\n"+FormatTagTree(tags))) // TODO: i18n
 	}
 
 	return nil
 }
 
+func (b *Bot) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+	if query.Message == nil || query.Message.Chat == nil {
+		return nil
+	}
+	chatID := query.Message.Chat.ID
+	fields := logrus.Fields{"chat_id": chatID, "callback_id": query.ID}
+	if query.From != nil {
+		fields["user_id"] = query.From.ID
+	}
+	ctx = ContextWithLogger(ctx, b.log(ctx).WithFields(fields))
+	// stop loading animation on button in any case
+	defer func() {
+		_, _ = b.api.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+	}()
+	if !b.allow(ctx, chatID, query.From, RateClassDefault, false) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	user, err := b.storage.GetUserByTelegramID(ctx, chatID)
+	if err != nil {
+		return b.handleError(chatID, err)
+	}
+	if user == nil || !user.Enabled {
+		return b.handleError(chatID, &UserNotFoundError{AdminContact: b.config.AdminContact})
+	}
+	if err := b.checkMember(ctx, user, query.Message.Chat, query.From); err != nil {
+		return b.handleError(chatID, err)
+	}
+
+	action, args := DecodeCallback(query.Data)
+	// arguments of callback may contain user data like search text, so only action is logged
+	b.log(ctx).WithField("action", action).Debug("handle callback")
+	switch action {
+	case callbackImportConfirm, callbackImportCancel:
+		return b.handleImportCallback(ctx, user, query.Message, query.From, action, args)
+	case callbackEntryMenu, callbackEntryDelete, callbackEntryDate, callbackEntryTag, callbackEntryCurrency:
+		if len(args) < 1 {
+			return nil
+		}
+		return b.handleEntryCallback(ctx, user, query.Message, action, args[0], args[1:])
+	case callbackLastPage:
+		if len(args) != 3 {
+			return nil
+		}
+		limit, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil
+		}
+		offset, err := strconv.Atoi(args[1])
+		if err != nil || offset < 0 {
+			return nil
+		}
+		// callback data comes from client, so it is not trusted to stay in bounds of buttons we sent
+		if limit < 1 {
+			limit = 1
+		} else if limit > lastMaxLimit {
+			limit = lastMaxLimit
+		}
+		text, keyboard, err := b.lastEntriesPage(ctx, user, strings.Fields(args[2]), offset, limit)
+		if err != nil {
+			return b.handleError(chatID, err)
+		}
+		edit := tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, text)
+		edit.ParseMode = "markdown"
+		edit.ReplyMarkup = keyboard
+		_, _ = b.send(edit)
+	case callbackFindPage:
+		// search text is the last argument and may contain separator
+		if len(args) < 4 {
+			return nil
+		}
+		offset, err := strconv.Atoi(args[0])
+		if err != nil || offset < 0 {
+			return nil
+		}
+		from, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		cmd := &FindCommand{
+			Text: strings.Join(args[3:], callbackSeparator),
+			From: time.Unix(from, 0),
+			Tags: strings.Fields(args[2]),
+		}
+		text, keyboard, entries, err := b.findEntriesPage(ctx, user, cmd, offset)
+		if err != nil {
+			return b.handleError(chatID, err)
+		}
+		edit := tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, text)
+		edit.ParseMode = "markdown"
+		edit.ReplyMarkup = keyboard
+		_, _ = b.send(edit)
+		b.replyEntries(chatID, entries)
+	}
+	return nil
+}
+
+// lastEntriesPage renders page of recent entries with navigation buttons
+func (b *Bot) lastEntriesPage(
+	ctx context.Context, user *User, tags []string, offset, limit int,
+) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	entries, total, err := b.storage.ListEntries(ctx, user, tags, offset, limit)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(entries) == 0 {
+		return "No entries", nil, nil // TODO: i18n
+	}
+
+	text := fmt.Sprintf(
+		"Entries %d-%d of %d\n%s", offset+1, offset+len(entries), total, FormatEntriesTable(entries),
+	) // TODO: i18n
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, 2)
+	page := func(title string, offset int) {
+		data := EncodeCallback(callbackLastPage, strconv.Itoa(limit), strconv.Itoa(offset), strings.Join(tags, " "))
+		// too long list of tags can not be passed to button, so pagination is not available
+		if ValidCallback(data) {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(title, data))
+		}
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		page("« Prev", prev)
+	}
+	if offset+limit < total {
+		page("Next »", offset+limit)
+	}
+	if len(buttons) == 0 {
+		return text, nil, nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(buttons...))
+	return text, &keyboard, nil
+}
+
+// findEntriesPage renders page of search results with navigation buttons,
+// period and tags of search are passed to buttons so every page is a result of the same query,
+// entries of the page are returned to link them with their original messages
+func (b *Bot) findEntriesPage(
+	ctx context.Context, user *User, cmd *FindCommand, offset int,
+) (string, *tgbotapi.InlineKeyboardMarkup, []*Entry, error) {
+	entries, total, err := b.storage.FindEntries(ctx, user, cmd.Text, cmd.From, cmd.Tags, offset, findPageSize)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if len(entries) == 0 {
+		return fmt.Sprintf("Found %d entries for %s", total, EscapeMarkdown(cmd.Text)), nil, nil, nil // TODO: i18n
+	}
+
+	text := fmt.Sprintf(
+		"Found %d entries for %s, %d-%d:\n%s",
+		total, EscapeMarkdown(cmd.Text), offset+1, offset+len(entries), FormatEntriesTable(entries),
+	) // TODO: i18n
+	var from int64
+	if !cmd.From.IsZero() {
+		from = cmd.From.Unix()
+	}
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, 2)
+	page := func(title string, offset int) {
+		data := EncodeCallback(
+			callbackFindPage, strconv.Itoa(offset), strconv.FormatInt(from, 10), strings.Join(cmd.Tags, " "), cmd.Text,
+		)
+		// too long search text can not be passed to button, so pagination is not available
+		if ValidCallback(data) {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(title, data))
+		}
+	}
+	if offset > 0 {
+		prev := offset - findPageSize
+		if prev < 0 {
+			prev = 0
+		}
+		page("« Prev", prev)
+	}
+	if offset+findPageSize < total {
+		page("Next »", offset+findPageSize)
+	}
+	if len(buttons) == 0 {
+		return text, nil, entries, nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(buttons...))
+	return text, &keyboard, entries, nil
+}
+
+// replyEntries sends every entry which was created from message as reply to that message,
+// so it is possible to jump to the original message from search results
+func (b *Bot) replyEntries(chatID int64, entries []*Entry) {
+	for _, entry := range entries {
+		if entry.MessageID == 0 {
+			continue
+		}
+		text := fmt.Sprintf("%.2f%s %s", entry.Value, entry.Currency, entry.CreatedAt.Format("2006-01-02"))
+		b.sendReply(chatID, int(entry.MessageID), text)
+	}
+}
+
+// sendReply sends text as reply to message, if original message is not available anymore sends it as is
+func (b *Bot) sendReply(chatID int64, messageID int, text string) {
+	reply := tgbotapi.NewMessage(chatID, text)
+	reply.ReplyToMessageID = messageID
+	if _, err := b.send(reply); err != nil {
+		reply.ReplyToMessageID = 0
+		_, _ = b.send(reply)
+	}
+}
+
 func (b *Bot) Start() error {
 	defer func() {
 		b.doneC <- struct{}{}
@@ -204,18 +715,43 @@ func (b *Bot) Start() error {
 		return err
 	}
 	b.api = bot
+	// bot has just got its profile from telegram
+	b.telegram.observe(nil)
+	close(b.startedC)
 	b.logger.WithField("name", bot.Self.UserName).Info("started")
+	if err := b.setCommands(); err != nil {
+		b.logger.WithError(err).Warn("failed to set commands menu")
+	}
 
 	updates, err := b.api.GetUpdatesChan(tgbotapi.UpdateConfig{Offset: 0, Limit: 0, Timeout: 60})
 	if err != nil {
 		return err
 	}
 
+	reportsCtx, cancelReports := context.WithCancel(context.Background())
+	reportsDoneC := make(chan struct{})
+	go func() {
+		b.runReports(reportsCtx)
+		close(reportsDoneC)
+	}()
+	defer func() {
+		cancelReports()
+		<-reportsDoneC
+	}()
+	defer func() {
+		b.cancelBackground()
+		b.background.Wait()
+	}()
+
 	for {
 		select {
 		case update := <-updates:
-			if err := b.handle(&update); err != nil {
-				b.logger.WithError(err).Error("failed to handle message")
+			ctx := ContextWithLogger(context.Background(), b.logger.WithFields(logrus.Fields{
+				"correlation_id": newCorrelationID(),
+				"update_id":      update.UpdateID,
+			}))
+			if err := b.handle(ctx, &update); err != nil {
+				b.log(ctx).WithError(err).Error("failed to handle message")
 			}
 		case <-b.stopC:
 			return nil
@@ -223,24 +759,76 @@ func (b *Bot) Start() error {
 	}
 }
 
+// goBackground runs task which outlives handling of update, its context carries logger of update
+// and is cancelled when bot stops
+func (b *Bot) goBackground(ctx context.Context, task func(ctx context.Context)) {
+	ctx = ContextWithLogger(b.backgroundCtx, b.log(ctx))
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+		task(ctx)
+	}()
+}
+
+// sendChangelog shows changes user missed since last message and remembers current version
+func (b *Bot) sendChangelog(ctx context.Context, user *User) {
+	if text := FormatChangelog(user.BotVersion); text != "" {
+		_, _ = b.send(tgbotapi.NewMessage(user.TelegramID, text))
+	}
+	version := user.BotVersion
+	user.BotVersion = VERSION
+	if _, err := b.storage.SaveUser(ctx, user); err != nil {
+		b.log(ctx).WithError(err).Error("failed to update bot version of user")
+		// changelog is shown again with next message
+		user.BotVersion = version
+	}
+}
+
+// setCommands registers list of commands so telegram clients can autocomplete them,
+// tgbotapi has no method for this yet
+func (b *Bot) setCommands() error {
+	data, err := json.Marshal(botCommands())
+	if err != nil {
+		return err
+	}
+	_, err = b.api.MakeRequest("setMyCommands", url.Values{"commands": {string(data)}})
+	return err
+}
+
+// Stop stops receiving updates and waits for background jobs, api is kept because jobs may still use it
 func (b *Bot) Stop() error {
 	b.stopC <- struct{}{}
-	if b.api != nil {
+	select {
+	case <-b.startedC:
 		b.api.StopReceivingUpdates()
-		b.api = nil
+	default:
 	}
 	<-b.doneC
 	b.logger.Info("stopped")
 	return nil
 }
 
-func New(token string, logger *logrus.Logger, storage Repository, config Config) (*Bot, error) {
+// New creates bot, its metrics are registered with registerer
+func New(
+	token string, logger *logrus.Logger, storage Repository, config Config, registerer prometheus.Registerer,
+) (*Bot, error) {
+	metrics := newBotMetrics()
+	if err := metrics.register(registerer); err != nil {
+		return nil, err
+	}
+	backgroundCtx, cancelBackground := context.WithCancel(context.Background())
 	return &Bot{
-		logger:  logger,
-		token:   token,
-		storage: storage,
-		config:  config,
-		stopC:   make(chan struct{}, 1),
-		doneC:   make(chan struct{}, 1),
+		logger:   logger,
+		token:    token,
+		storage:  storage,
+		config:   config,
+		limiter:  newRateLimiter(config.RateLimits),
+		stopC:    make(chan struct{}, 1),
+		startedC: make(chan struct{}),
+		doneC:    make(chan struct{}, 1),
+
+		backgroundCtx:    backgroundCtx,
+		cancelBackground: cancelBackground,
+		metrics:          metrics,
 	}, nil
 }
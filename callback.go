@@ -0,0 +1,35 @@
+package accounting_bot
+
+import "strings"
+
+// telegram limits callback data of inline keyboard buttons to 64 bytes
+const (
+	callbackMaxLength = 64
+	callbackSeparator = ":"
+)
+
+const (
+	callbackLastPage      = "last"
+	callbackFindPage      = "find"
+	callbackEntryMenu     = "menu"
+	callbackEntryDelete   = "del"
+	callbackEntryDate     = "date"
+	callbackEntryTag      = "tag"
+	callbackEntryCurrency = "cur"
+	callbackImportConfirm = "imp"
+	callbackImportCancel  = "impx"
+)
+
+// EncodeCallback packs action and its arguments into inline keyboard button data
+func EncodeCallback(action string, args ...string) string {
+	return strings.Join(append([]string{action}, args...), callbackSeparator)
+}
+
+func DecodeCallback(data string) (string, []string) {
+	parts := strings.Split(data, callbackSeparator)
+	return parts[0], parts[1:]
+}
+
+func ValidCallback(data string) bool {
+	return len(data) <= callbackMaxLength
+}
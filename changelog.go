@@ -0,0 +1,39 @@
+package accounting_bot
+
+import (
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//go:embed CHANGELOG.md
+var changelogSource string
+
+// changes made in each version of bot, parsed from CHANGELOG.md where versions are "## <version>" headers
+var changelog = make(map[int]string)
+
+func init() {
+	for _, section := range strings.Split(changelogSource, "## ")[1:] {
+		lines := strings.SplitN(section, "\n", 2)
+		version, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+		if err != nil {
+			panic(fmt.Sprintf("invalid version in changelog: %s", lines[0]))
+		}
+		if len(lines) > 1 {
+			changelog[version] = strings.TrimSpace(lines[1])
+		}
+	}
+}
+
+// FormatChangelog returns changes made after version, newest first
+func FormatChangelog(since int) string {
+	// TODO: i18n
+	b := strings.Builder{}
+	for version := VERSION; version > since; version-- {
+		if changes, ok := changelog[version]; ok {
+			b.WriteString(fmt.Sprintf("What's new in version %d:\n%s\n\n", version, changes))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,141 @@
+package accounting_bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/borodyadka/accounting-bot/charts"
+)
+
+// maxChartBars limits number of bars, only the most recent periods are shown
+const maxChartBars = 90
+
+var chartLabelFormats = map[string]string{
+	"day":   "01-02",
+	"week":  "01-02",
+	"month": "2006-01",
+}
+
+// renderChart renders chart requested by command as png image with caption, only spendings in user's currency are shown
+func (b *Bot) renderChart(ctx context.Context, user *User, cmd *ChartCommand) ([]byte, string, error) {
+	var img image.Image
+	var caption strings.Builder
+	switch cmd.Kind {
+	case "bar":
+		items, err := b.storage.SumByPeriods(ctx, user, cmd.From, cmd.Tags, cmd.Group)
+		if err != nil {
+			return nil, "", err
+		}
+		loc := user.Location()
+		sums := make(map[int64]float32, len(items))
+		start := time.Time{}
+		if !cmd.From.IsZero() {
+			start = truncatePeriod(cmd.From.In(loc), cmd.Group)
+		}
+		var total float32
+		for _, item := range items {
+			if item.Currency != user.Currency {
+				continue
+			}
+			total += item.Total
+			sums[item.Start.Unix()] += item.Total
+			if start.IsZero() {
+				start = item.Start.In(loc)
+			}
+		}
+		// periods without spendings are shown as empty bars, so bars make a time axis
+		values := make([]charts.Value, 0, len(items))
+		if !start.IsZero() {
+			end := truncatePeriod(time.Now().In(loc), cmd.Group)
+			// bars before the most recent ones are not shown anyway, so they are not generated
+			if earliest := prevPeriods(end, cmd.Group, maxChartBars-1); start.Before(earliest) {
+				start = earliest
+			}
+			for t := start; !t.After(end); t = nextPeriod(t, cmd.Group) {
+				values = append(values, charts.Value{
+					Label: t.Format(chartLabelFormats[cmd.Group]),
+					Value: float64(sums[t.Unix()]),
+				})
+			}
+		}
+		if len(values) > maxChartBars {
+			values = values[len(values)-maxChartBars:]
+		}
+		img = charts.Bar(values)
+		caption.WriteString(fmt.Sprintf("Total %.2f%s", total, user.Currency)) // TODO: i18n
+	default:
+		tags, err := b.storage.SumByTags(ctx, user, cmd.From, cmd.Tags)
+		if err != nil {
+			return nil, "", err
+		}
+		values := make([]charts.Value, 0, len(charts.Palette))
+		var total float32
+		for _, tag := range tags {
+			if tag.Currency != user.Currency {
+				continue
+			}
+			total += tag.Total
+			if tag.Tag == "" {
+				tag.Tag = "untagged" // TODO: i18n
+			}
+			// the last color is used for all remaining tags
+			if len(values) == len(charts.Palette) {
+				values[len(values)-1].Label = "other" // TODO: i18n
+				values[len(values)-1].Value += float64(tag.Total)
+				continue
+			}
+			values = append(values, charts.Value{Label: tag.Tag, Value: float64(tag.Total)})
+		}
+		img = charts.Pie(values)
+		// every entry is counted only by its first tag, so slices add up to total
+		caption.WriteString(fmt.Sprintf("Total %.2f%s by first tag\n", total, user.Currency)) // TODO: i18n
+		for i, v := range values {
+			caption.WriteString(fmt.Sprintf("%s %s %.2f%s\n", charts.PaletteEmoji[i], v.Label, v.Value, user.Currency))
+		}
+	}
+
+	buff := bytes.NewBuffer(make([]byte, 0, 32*1024))
+	if err := png.Encode(buff, img); err != nil {
+		return nil, "", NewInternalError(err)
+	}
+	return buff.Bytes(), strings.TrimSpace(caption.String()), nil
+}
+
+// truncatePeriod returns beginning of day, week or month containing t, weeks begin on monday
+func truncatePeriod(t time.Time, group string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch group {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// nextPeriod returns beginning of period following the one beginning at t
+func nextPeriod(t time.Time, group string) time.Time {
+	switch group {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// prevPeriods returns beginning of period n periods before the one beginning at t
+func prevPeriods(t time.Time, group string, n int) time.Time {
+	switch group {
+	case "week":
+		return t.AddDate(0, 0, -7*n)
+	case "month":
+		return t.AddDate(0, -n, 0)
+	}
+	return t.AddDate(0, 0, -n)
+}
@@ -0,0 +1,57 @@
+package charts
+
+import (
+	"image"
+	"image/draw"
+	"strconv"
+)
+
+const (
+	barMargin     = 40
+	barLabelWidth = 50
+)
+
+// Bar renders bar chart of values with labels under bars, labels are skipped when there is no space for them
+func Bar(values []Value) image.Image {
+	img := newCanvas()
+	if len(values) == 0 {
+		return img
+	}
+
+	var max float64
+	for _, v := range values {
+		if v.Value > max {
+			max = v.Value
+		}
+	}
+
+	left, right := barMargin+textWidth(strconv.FormatFloat(max, 'f', 0, 64)), Width-barMargin
+	top, bottom := barMargin, Height-barMargin
+	// axes
+	draw.Draw(img, image.Rect(left, top, left+1, bottom), &image.Uniform{C: foreground}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(left, bottom, right, bottom+1), &image.Uniform{C: foreground}, image.Point{}, draw.Src)
+	if max <= 0 {
+		return img
+	}
+	drawText(img, barMargin/2, top+5, strconv.FormatFloat(max, 'f', 0, 64))
+
+	step := float64(right-left-1) / float64(len(values))
+	gap := int(step / 5)
+	labelEvery := 1 + barLabelWidth/int(step+1)
+	for i, v := range values {
+		x0 := left + 1 + int(float64(i)*step) + gap/2
+		x1 := left + 1 + int(float64(i+1)*step) - gap/2
+		if x1 <= x0 {
+			x1 = x0 + 1
+		}
+		h := int(v.Value / max * float64(bottom-top))
+		draw.Draw(
+			img, image.Rect(x0, bottom-h, x1, bottom),
+			&image.Uniform{C: Palette[4]}, image.Point{}, draw.Src,
+		)
+		if i%labelEvery == 0 {
+			drawText(img, (x0+x1-textWidth(v.Label))/2, bottom+16, v.Label)
+		}
+	}
+	return img
+}
@@ -0,0 +1,63 @@
+package charts
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	Width  = 800
+	Height = 500
+)
+
+// Palette of chart colors, matches colored square emojis, so legend can be sent as message text
+var Palette = []color.RGBA{
+	{R: 0xdd, G: 0x2e, B: 0x44, A: 0xff},
+	{R: 0xf4, G: 0x90, B: 0x0c, A: 0xff},
+	{R: 0xfd, G: 0xcb, B: 0x58, A: 0xff},
+	{R: 0x78, G: 0xb1, B: 0x59, A: 0xff},
+	{R: 0x55, G: 0xac, B: 0xee, A: 0xff},
+	{R: 0xaa, G: 0x8e, B: 0xd6, A: 0xff},
+	{R: 0xc1, G: 0x69, B: 0x4f, A: 0xff},
+	{R: 0x31, G: 0x37, B: 0x3d, A: 0xff},
+}
+
+// PaletteEmoji contains colored squares in the same order as Palette
+var PaletteEmoji = []string{"🟥", "🟧", "🟨", "🟩", "🟦", "🟪", "🟫", "⬛"}
+
+var (
+	background = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	foreground = color.RGBA{R: 0x31, G: 0x37, B: 0x3d, A: 0xff}
+)
+
+// Value is a single labeled value of chart
+type Value struct {
+	Label string
+	Value float64
+}
+
+func newCanvas() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+	return img
+}
+
+// drawText draws ascii text with baseline at x, y
+func drawText(img draw.Image, x, y int, text string) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  &image.Uniform{C: foreground},
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+func textWidth(text string) int {
+	return font.MeasureString(basicfont.Face7x13, text).Round()
+}
@@ -0,0 +1,48 @@
+package charts
+
+import (
+	"image"
+	"math"
+)
+
+// Pie renders pie chart of values, colors of slices are taken from Palette in order of values
+func Pie(values []Value) image.Image {
+	img := newCanvas()
+
+	var total float64
+	for _, v := range values {
+		total += v.Value
+	}
+	if total <= 0 {
+		return img
+	}
+
+	// slice boundaries as angles clockwise from 12 o'clock
+	bounds := make([]float64, len(values))
+	var acc float64
+	for i, v := range values {
+		acc += v.Value
+		bounds[i] = acc / total * 2 * math.Pi
+	}
+
+	cx, cy := Width/2, Height/2
+	r := Height/2 - 20
+	for y := cy - r; y <= cy+r; y++ {
+		for x := cx - r; x <= cx+r; x++ {
+			dx, dy := float64(x-cx), float64(y-cy)
+			if dx*dx+dy*dy > float64(r*r) {
+				continue
+			}
+			angle := math.Atan2(dx, -dy)
+			if angle < 0 {
+				angle += 2 * math.Pi
+			}
+			i := 0
+			for i < len(bounds)-1 && angle > bounds[i] {
+				i++
+			}
+			img.SetRGBA(x, y, Palette[i%len(Palette)])
+		}
+	}
+	return img
+}
@@ -12,18 +12,30 @@ import (
 
 var (
 	logLevel    log.Level
+	logFormat   log.Formatter
 	databaseURL *url.URL
 	botToken    string
+	httpAddr    string
 	botConfig   = accbot.Config{
 		AuthCode: "",
 	}
 )
 
 type specification struct {
-	LogLevel    string `envconfig:"LOG_LEVEL" default:"INFO"`
-	DatabaseURL string `envconfig:"DATABASE_URL"`
-	BotToken    string `envconfig:"TELEGRAM_BOT_TOKEN"`
-	AuthCode    string `envconfig:"AUTH_CODE"`
+	LogLevel     string  `envconfig:"LOG_LEVEL" default:"INFO"`
+	LogFormat    string  `envconfig:"LOG_FORMAT" default:"text"`
+	DatabaseURL  string  `envconfig:"DATABASE_URL"`
+	BotToken     string  `envconfig:"TELEGRAM_BOT_TOKEN"`
+	AuthCode     string  `envconfig:"AUTH_CODE"`
+	AdminIDs     []int64 `envconfig:"ADMIN_IDS"`
+	AdminContact string  `envconfig:"ADMIN_CONTACT"`
+	InviteOnly   bool    `envconfig:"INVITE_ONLY"`
+	HTTPAddr     string  `envconfig:"HTTP_ADDR"`
+	// requests per minute and burst of all messages and of heavy commands like /dump, zero disables limit
+	RateLimit           float64 `envconfig:"RATE_LIMIT" default:"30"`
+	RateLimitBurst      int     `envconfig:"RATE_LIMIT_BURST" default:"10"`
+	HeavyRateLimit      float64 `envconfig:"HEAVY_RATE_LIMIT" default:"2"`
+	HeavyRateLimitBurst int     `envconfig:"HEAVY_RATE_LIMIT_BURST" default:"3"`
 }
 
 func parseConfig() error {
@@ -39,7 +51,11 @@ func parseConfig() error {
 	if err != nil {
 		return err
 	}
-	log.SetFormatter(&log.TextFormatter{DisableSorting: false})
+	logFormat, err = accbot.NewFormatter(config.LogFormat)
+	if err != nil {
+		return err
+	}
+	log.SetFormatter(logFormat)
 	log.SetOutput(os.Stdout)
 	log.SetLevel(logLevel)
 
@@ -56,7 +72,16 @@ func parseConfig() error {
 		log.Fatal("TELEGRAM_BOT_TOKEN is not provided")
 	}
 
+	httpAddr = config.HTTPAddr
+
 	botConfig.AuthCode = config.AuthCode
+	botConfig.Admins = config.AdminIDs
+	botConfig.AdminContact = config.AdminContact
+	botConfig.InviteOnly = config.InviteOnly
+	botConfig.RateLimits = map[string]accbot.RateLimit{
+		accbot.RateClassDefault: {PerMinute: config.RateLimit, Burst: config.RateLimitBurst},
+		accbot.RateClassHeavy:   {PerMinute: config.HeavyRateLimit, Burst: config.HeavyRateLimitBurst},
+	}
 
 	return nil
 }
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	accbot "github.com/borodyadka/accounting-bot"
+	_ "github.com/borodyadka/accounting-bot/dumpers"
+	_ "github.com/borodyadka/accounting-bot/importers"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
-type repositoryFactory func(url string) (accbot.Repository, error)
+type repositoryFactory func(url string, logger *logrus.Logger) (accbot.Repository, error)
 
 var repositories = make(map[string]repositoryFactory)
 
@@ -20,20 +27,20 @@ func registerRepository(provider string, factory repositoryFactory) {
 
 func main() {
 	if err := parseConfig(); err != nil {
-		accbot.NewLogger(logrus.ErrorLevel, "bot").Fatal(err)
+		accbot.NewLogger(logrus.ErrorLevel, "bot", logFormat).Fatal(err)
 	}
-	logger := accbot.NewLogger(logLevel, "bot")
+	logger := accbot.NewLogger(logLevel, "bot", logFormat)
 
 	factory, sok := repositories[databaseURL.Scheme]
 	if !sok {
 		logger.Fatalf(`unknown database type "%s"`, databaseURL.Scheme)
 	}
-	storage, err := factory(databaseURL.String())
+	storage, err := factory(databaseURL.String(), accbot.NewLogger(logLevel, "storage", logFormat))
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	bot, err := accbot.New(botToken, logger, storage, botConfig)
+	bot, err := accbot.New(botToken, logger, storage, botConfig, prometheus.DefaultRegisterer)
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -45,6 +52,18 @@ func main() {
 		}
 	}(bot)
 
+	// metrics and health checks are served only when address is configured
+	var server *http.Server
+	if httpAddr != "" {
+		server = &http.Server{Addr: httpAddr, Handler: bot.Handler()}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errC <- err
+			}
+		}()
+		logger.WithField("addr", httpAddr).Info("http listener started")
+	}
+
 	sigC := make(chan error, 1)
 	go func() {
 		c := make(chan os.Signal, 1)
@@ -54,6 +73,11 @@ func main() {
 
 	select {
 	case sig := <-sigC:
+		if server != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = server.Shutdown(ctx)
+			cancel()
+		}
 		bot.Stop()
 		logger.Info(sig)
 		return
@@ -5,10 +5,12 @@ package main
 import (
 	"github.com/borodyadka/accounting-bot"
 	"github.com/borodyadka/accounting-bot/storage/postgres"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 )
 
 func init() {
-	registerRepository("postgres", func(url string) (accounting_bot.Repository, error) {
-		return postgres.New(url)
+	registerRepository("postgres", func(url string, logger *logrus.Logger) (accounting_bot.Repository, error) {
+		return postgres.New(url, logger, prometheus.DefaultRegisterer)
 	})
 }
@@ -1,6 +1,7 @@
 package accounting_bot
 
 import (
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -11,30 +12,35 @@ import (
 )
 
 var (
-	reHelp = regexp.MustCompile(`^/help`)
-	reDump = regexp.MustCompile(`^/(?P<cmd>dump\s*)`)
-	reStat = regexp.MustCompile(`^/(?P<cmd>(sum|max|maximum|min|minimum|avg|average|med|median)\B)`) // TODO
-	// /start [code] - to authorize user
-	reStart = regexp.MustCompile(`^/(?P<cmd>start)(\s+(?P<code>[\w\d]+))?`)
-	// /currency RUB - to set user currency
-	reCurrency = regexp.MustCompile(`^/(?P<cmd>currency)(\s+(?P<code>[\w]{3}))`)
-	// /tag #burger #food - to add tag #food to all #burger entries
-	reTag = regexp.MustCompile(`^/tag\s+`)
-	// /untag #burger - to remove all #burger tags (not entries)
-	reUntag = regexp.MustCompile(`^/untag\s+`)
-	// /tags - list all tags and number of usages
-	// /tags #food - list all tags on entries with #food tag
-	reTags = regexp.MustCompile(`^/tags\s*`)
-	// <value> [comment with #hashtags]
-	reEntry      = regexp.MustCompile(`^(?P<value>\d+(\.\d+)?)(?P<comment>\s?.*)$`)
-	reHashTags   = regexp.MustCompile(`(\B#[\p{L}\d]+)`)
-	rePeriod     = regexp.MustCompile(`(((?P<period>\d+)\s+)?(?P<modifier>years?|months?|weeks?|days?|hours?))`)
-	reDumpFormat = regexp.MustCompile(`(?P<format>csv|sqlite)`)
+	// in group chats commands are sent as /command@bot_name
+	reCommandMention = regexp.MustCompile(`^(/\w+)@\w+`)
+
+	// <value> [comment with #hashtags, $account and @members to split expense with]
+	reEntry = regexp.MustCompile(`^(?P<value>[\d(][\d.,+\-*/()]*)(?P<comment>\s?.*)$`)
+	// thousands are grouped with spaces like "12 100" only in locales with comma decimal separator
+	reEntryGrouped = regexp.MustCompile(`^(?P<value>[\d(](?:[\d.,+\-*/()]| \d{3}\b)*)(?P<comment>\s?.*)$`)
+	// names of accounts are not numbers, so "$5" in comment is not an account
+	reAccount     = regexp.MustCompile(`\B\$(?P<name>\d*[A-Za-z_]\w*)`)
+	reAccountName = regexp.MustCompile(`^\d*[A-Za-z_]\w*$`)
+	reMentions    = regexp.MustCompile(`\B@(?P<name>\w+)`)
+	// hashtags may be nested with slashes, e.g. #food/restaurant
+	reHashTags = regexp.MustCompile(`(\B#[\p{L}\d]+(/[\p{L}\d]+)*)`)
+	reName     = regexp.MustCompile(`^\w+$`)
+	// account names in ledger and beancount dumps, e.g. Expenses:Food
+	reLedgerAccount = regexp.MustCompile(`^[\p{L}\d:-]+$`)
+)
+
+const (
+	entrySyntax  = "<amount> [comment with #tags, $account and @members]"
+	entryExample = "12.5+3 lunch #food"
 )
 
 type Command interface{}
 
-type HelpCommand struct{}
+type HelpCommand struct {
+	// Command is a name of command to show help of, empty for list of all commands
+	Command string
+}
 
 type StartCommand struct {
 	Code string
@@ -50,13 +56,80 @@ type DumpCommand struct {
 	Tags   []string
 }
 
-type StatCommand struct {
+type FindCommand struct {
+	Text string
 	From time.Time
 	Tags []string
+	Page int
+}
+
+type LastCommand struct {
+	Limit int
+	Tags  []string
+}
+
+type ChartCommand struct {
+	Kind  string
+	Group string
+	From  time.Time
+	Tags  []string
+}
+
+type ReportCommand struct {
+	Period string
+}
+
+type TimezoneCommand struct {
+	Timezone string
+}
+
+type JoinCommand struct{}
+
+type MembersCommand struct {
+	From time.Time
+}
+
+type DebtsCommand struct{}
+
+type SettleCommand struct {
+	Name  string
+	Value float32
+}
+
+type MapAccountCommand struct {
+	Tag     string
+	Account string
+}
+
+type ListMapAccountsCommand struct{}
+
+type AddAccountCommand struct {
+	Account Account
+	Value   float32
+}
+
+type ListAccountsCommand struct{}
+
+type TransferCommand struct {
+	From  string
+	To    string
+	Value float32
+}
+
+// ImportCommand is sent as document with optional layout of columns in caption
+type ImportCommand struct {
+	FileID   string
+	FileName string
+	FileSize int
+	Layout   string
 }
 
 type EntryCommand struct {
 	Entry Entry
+	// Split contains names of ledger members sharing expense with author
+	Split []string
+	// SplitIDs contains telegram ids of members without username, they are mentioned by links to profile
+	SplitIDs []int64
 }
 
 type AddTagCommand struct {
@@ -68,6 +141,38 @@ type RemoveTagCommand struct {
 	Tags []string
 }
 
+type MergeTagsCommand struct {
+	Tags []string
+	Into string
+}
+
+type AddRuleCommand struct {
+	Rule Rule
+}
+
+type DeleteRuleCommand struct {
+	ID string
+}
+
+type ApplyRuleCommand struct {
+	ID string
+}
+
+type ListRulesCommand struct{}
+
+// AdminCommand is a command available only to admins of bot
+type AdminCommand struct {
+	Action     string
+	TelegramID int64
+	Text       string
+}
+
+// InviteCommand creates invite code, it is available only to admins of bot
+type InviteCommand struct {
+	MaxUses int
+	TTL     time.Duration
+}
+
 type ListTagsCommand struct {
 	SearchTags []string
 }
@@ -99,118 +204,766 @@ func getPeriodBeginning(period int, modifier string) time.Time {
 	return result
 }
 
-func getDumpFormat(s string) string {
-	matches := reDumpFormat.FindAllString(s, -1)
-	if len(matches) == 0 {
-		return ""
+// CommandSpec declares grammar of command once: name with aliases, syntax of arguments shown in help and errors,
+// and parser of arguments
+type CommandSpec struct {
+	Name    string
+	Aliases []string
+	Args    string
+	// Help is a short description shown in list of commands, Details are shown in help of command
+	Help    string
+	Details string
+	Example string
+	Parse   func(p *argParser) (Command, error)
+	// Admin commands are available only to admins of bot and are not listed in help and command menu
+	Admin bool
+}
+
+// Usage returns syntax of command like "/rename #old #new"
+func (c *CommandSpec) Usage() string {
+	return strings.TrimSpace(c.Name + " " + c.Args)
+}
+
+// commands in order they are listed in help
+var commands = []*CommandSpec{
+	{
+		Name:    "/help",
+		Args:    "[command]",
+		Help:    "show this help",
+		Details: "Without arguments lists all commands, with name of command shows its usage and examples.",
+		Example: "/help dump",
+		Parse:   parseHelpCommand,
+	},
+	{
+		Name:    "/start",
+		Args:    "[code]",
+		Help:    "start using bot",
+		Details: "Creates ledger for this chat. Code is required when bot is protected with invite code.",
+		Example: "/start secret",
+		Parse:   parseStartCommand,
+	},
+	{
+		Name:    "/currency",
+		Args:    "<code>",
+		Help:    "set default currency",
+		Details: "Currency is a three letter ISO 4217 code, it is used for new entries without account.",
+		Example: "/currency EUR",
+		Parse:   parseCurrencyCommand,
+	},
+	{
+		Name:    "/timezone",
+		Aliases: []string{"/tz"},
+		Args:    "<name>",
+		Help:    "set timezone",
+		Details: "Timezone from IANA database, used for reports and dates of entries.",
+		Example: "/timezone Europe/Moscow",
+		Parse:   parseTimezoneCommand,
+	},
+	{
+		Name:    "/last",
+		Args:    "[1-50] [#tags]",
+		Help:    "show recent entries",
+		Details: "Shows 10 most recent entries by default, filtered by tags including nested ones.",
+		Example: "/last 20 #food",
+		Parse:   parseLastCommand,
+	},
+	{
+		Name:    "/find",
+		Aliases: []string{"/search"},
+		Args:    "<text> [period] [#tags] [page N]",
+		Help:    "search entries by comment",
+		Details: "Searches words in comments, period like 2 months limits how old entries are.",
+		Example: "/find coffee 2 months",
+		Parse:   parseFindCommand,
+	},
+	{
+		Name:    "/chart",
+		Args:    "[pie|bar] [by day|week|month] [period] [#tags]",
+		Help:    "draw chart of spendings",
+		Details: "Pie chart shows spendings by the first tag of entries, bar chart shows spendings by days, weeks or months.",
+		Example: "/chart bar by week 3 months",
+		Parse:   parseChartCommand,
+	},
+	{
+		Name:    "/report",
+		Args:    "weekly|monthly|off",
+		Help:    "subscribe to summary reports",
+		Details: "Report with totals and top tags is sent in the morning of the first day of period.",
+		Example: "/report weekly",
+		Parse:   parseReportCommand,
+	},
+	{
+		Name:    "/dump",
+		Aliases: []string{"/export"},
+		Args:    "[csv|ledger|beancount] [period] [#tags]",
+		Help:    "export entries to file",
+		Details: "Exports entries to csv by default, tags can be mapped to accounts of ledger with /map.",
+		Example: "/dump ledger 3 months #food",
+		Parse:   parseDumpCommand,
+	},
+	{
+		Name:    "/tags",
+		Args:    "[#tags]",
+		Help:    "list tags with number of usages",
+		Details: "Shows tree of nested tags, with tags lists only ones used along with them.",
+		Example: "/tags #food",
+		Parse:   parseListTagsCommand,
+	},
+	{
+		Name:    "/tag",
+		Args:    "#search #tag...",
+		Help:    "add tags to entries with tag",
+		Details: "Adds tags to all entries tagged with first one.",
+		Example: "/tag #burger #food",
+		Parse:   parseAddTagCommand,
+	},
+	{
+		Name:    "/untag",
+		Args:    "#tag...",
+		Help:    "remove tags from all entries",
+		Details: "Removes tags, entries stay untouched.",
+		Example: "/untag #burger",
+		Parse:   parseRemoveTagCommand,
+	},
+	{
+		Name:    "/rename",
+		Args:    "#old #new",
+		Help:    "rename tag",
+		Details: "Replaces tag on all entries, useful to fix typos.",
+		Example: "/rename #fod #food",
+		Parse:   parseRenameCommand,
+	},
+	{
+		Name:    "/merge",
+		Args:    "#tag... #into",
+		Help:    "replace tags with one tag",
+		Details: "Replaces all tags but last with the last one on all entries.",
+		Example: "/merge #cafe #restaurant #food",
+		Parse:   parseMergeCommand,
+	},
+	{
+		Name:    "/rule",
+		Args:    `"keyword"|/regexp/ #tags... or delete|apply <id>`,
+		Help:    "tag new entries automatically",
+		Details: "Adds tags to new entries which comment contains keyword or matches regular expression.",
+		Example: `/rule "starbucks" #coffee`,
+		Parse:   parseRuleCommand,
+	},
+	{
+		Name:    "/rules",
+		Help:    "list rules",
+		Details: "Shows rules with ids to delete or apply them to existing entries.",
+		Parse:   noArgs(&ListRulesCommand{}),
+	},
+	{
+		Name:    "/account",
+		Args:    "add <name> <currency> [balance]",
+		Help:    "add account",
+		Details: "Entries with $name in comment are paid from account and use its currency.",
+		Example: "/account add card USD 1000",
+		Parse:   parseAddAccountCommand,
+	},
+	{
+		Name:    "/accounts",
+		Help:    "list accounts with balances",
+		Details: "Shows balances of accounts including entries and transfers.",
+		Parse:   noArgs(&ListAccountsCommand{}),
+	},
+	{
+		Name:    "/transfer",
+		Args:    "<amount> <from> <to>",
+		Help:    "move money between accounts",
+		Details: "Accounts must have the same currency.",
+		Example: "/transfer 100 card cash",
+		Parse:   parseTransferCommand,
+	},
+	{
+		Name:    "/map",
+		Args:    "[#tag [account]]",
+		Help:    "map tag to account of ledger and beancount dumps",
+		Details: "Without account removes mapping, without arguments lists all mappings.",
+		Example: "/map #food Expenses:Food",
+		Parse:   parseMapAccountCommand,
+	},
+	{
+		Name:    "/join",
+		Help:    "join shared ledger of group chat",
+		Details: "Members of group chat must join before adding entries.",
+		Parse:   noArgs(&JoinCommand{}),
+	},
+	{
+		Name:    "/members",
+		Args:    "[period]",
+		Help:    "list members of shared ledger",
+		Details: "Shows spendings of each member for period.",
+		Example: "/members 1 month",
+		Parse:   parseMembersCommand,
+	},
+	{
+		Name:    "/debts",
+		Help:    "show who owes whom",
+		Details: "Calculates the fewest payments to settle shared expenses, groups over 16 members with debts are settled approximately.",
+		Parse:   noArgs(&DebtsCommand{}),
+	},
+	{
+		Name:    "/settle",
+		Args:    "@member <amount>",
+		Help:    "record payment to member",
+		Details: "Reduces your debt to member by amount.",
+		Example: "/settle @alice 20",
+		Parse:   parseSettleCommand,
+	},
+	{
+		Name:    "/admin",
+		Args:    "users|stats|enable <id>|disable <id>|broadcast <text>",
+		Help:    "manage users",
+		Details: "Available only to admins of bot.",
+		Example: "/admin disable 123456",
+		Parse:   parseAdminCommand,
+		Admin:   true,
+	},
+	{
+		Name:    "/invite",
+		Args:    "[uses] [period]",
+		Help:    "create invite code",
+		Details: "Creates code to /start using bot, by default it can be used once during a week.",
+		Example: "/invite 5 1 month",
+		Parse:   parseInviteCommand,
+		Admin:   true,
+	},
+}
+
+// commands by name and aliases
+var commandsByName = make(map[string]*CommandSpec)
+
+func init() {
+	for _, spec := range commands {
+		commandsByName[spec.Name] = spec
+		for _, alias := range spec.Aliases {
+			commandsByName[alias] = spec
+		}
 	}
-	return matches[0]
 }
 
+// ParseCommand parses message into command, syntax errors are described with expected usage of command
 func ParseCommand(message *tgbotapi.Message) (Command, error) {
-	s := strings.TrimSpace(message.Text)
-	// show help
-	if reHelp.Match([]byte(s)) {
-		return &HelpCommand{}, nil
-	}
-	// start bot for user
-	if m, ok := getMatches(reStart, s); ok {
-		return &StartCommand{Code: m["code"]}, nil
-	}
-	// request dump
-	if reDump.Match([]byte(s)) {
-		cmd := &DumpCommand{
-			From:   time.Time{},
-			Format: "csv",
-			Tags:   extractHashTags(s),
-		}
-		if mf, ok := getMatches(reDumpFormat, s); ok {
-			cmd.Format = mf["format"]
-		}
-		if mp, ok := getMatches(rePeriod, s); ok {
-			sp := strings.TrimSpace(mp["period"])
-			var period int64 = 1
-			if sp != "" {
-				var err error
-				period, err = strconv.ParseInt(sp, 10, 32)
-				if err != nil {
-					return nil, &InvalidSyntaxError{ /*TODO: more info*/ }
-				}
-			}
-			cmd.From = getPeriodBeginning(int(period), mp["modifier"])
+	cmd, err := parseCommand(message)
+	if err, ok := err.(*InvalidSyntaxError); ok {
+		s := reCommandMention.ReplaceAllString(strings.TrimSpace(message.Text), "$1")
+		describeSyntaxError(err, s)
+	}
+	return cmd, err
+}
+
+// commandName returns name of command like "/dump" or empty string if message is not a command
+func commandName(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	return fields[0]
+}
+
+// describeSyntaxError adds to error usage of command and position of token which failed to parse
+func describeSyntaxError(err *InvalidSyntaxError, s string) {
+	if err.Command == "" {
+		err.Command = commandName(s)
+	}
+	if err.Expected == "" {
+		err.Expected, err.Example = entrySyntax, entryExample
+		if spec, ok := commandsByName[strings.ToLower(err.Command)]; ok {
+			err.Expected, err.Example = spec.Usage(), spec.Example
 		}
-		return cmd, nil
 	}
-	// add entry
-	if m, ok := getMatches(reEntry, s); ok {
-		value, err := strconv.ParseFloat(m["value"], 64)
-		if err != nil {
-			return nil, NewInternalError(err)
-		}
-		hashtags := extractHashTags(m["comment"])
-		return &EntryCommand{
-			Entry{
-				CreatedAt: time.Now(),
-				Comment:   strings.TrimSpace(m["comment"]),
-				Tags:      hashtags,
-				Value:     float32(value),
-				MessageID: int64(message.MessageID),
-			},
+	if err.Token != "" && !err.HasPosition {
+		if i := strings.Index(s, err.Token); i >= 0 {
+			err.Position, err.HasPosition = i, true
+		}
+	}
+}
+
+func parseCommand(message *tgbotapi.Message) (Command, error) {
+	// files shared in group chat are not meant for bot unless they look like bank statements
+	if message.Document != nil && (message.Chat == nil || !isGroupChat(message.Chat) ||
+		isImportFile(message.Document.FileName)) {
+		return &ImportCommand{
+			FileID:   message.Document.FileID,
+			FileName: message.Document.FileName,
+			FileSize: message.Document.FileSize,
+			Layout:   message.Caption,
 		}, nil
 	}
-	// set currency
-	if m, ok := getMatches(reCurrency, s); ok {
-		_, err := currency.ParseISO(m["code"])
-		if err != nil {
-			return nil, &InvalidCurrencyError{Currency: m["code"]}
+	s := reCommandMention.ReplaceAllString(strings.TrimSpace(message.Text), "$1")
+	var decimal byte
+	if message.From != nil {
+		decimal = decimalSeparator(message.From.LanguageCode)
+	}
+	name := commandName(s)
+	if name == "" {
+		return parseEntryCommand(message, s, decimal)
+	}
+	spec, ok := commandsByName[strings.ToLower(name)]
+	if !ok {
+		return nil, &UnknownCommandError{Command: s, Suggestion: suggestCommand(strings.ToLower(name))}
+	}
+	tokens, err := tokenize(s[len(name):], len(name))
+	if err != nil {
+		return nil, err
+	}
+	return spec.Parse(&argParser{tokens: tokens, source: s, decimal: decimal})
+}
+
+func parseEntryCommand(message *tgbotapi.Message, s string, decimal byte) (Command, error) {
+	m, ok := getMatches(reEntryGrouped, s)
+	if !ok {
+		return nil, &UnknownCommandError{Command: s}
+	}
+	if strings.Contains(m["value"], " ") && decimal != ',' {
+		plain, _ := getMatches(reEntry, s)
+		if decimal == 0 {
+			// e.g. "12 100 coffee" is either 12100 or 12 for "100 coffee"
+			return nil, &InvalidSyntaxError{
+				Token:    m["value"],
+				Expected: strings.ReplaceAll(m["value"], " ", "") + " or " + plain["value"],
+			}
 		}
-		return &CurrencyCommand{Currency: m["code"]}, nil
+		m = plain
 	}
+	value, err := EvalExpression(m["value"], decimal)
+	if err != nil {
+		return nil, err
+	}
+	if value <= 0 {
+		return nil, &InvalidSyntaxError{Token: m["value"]}
+	}
+	cmd := &EntryCommand{
+		Entry: Entry{
+			CreatedAt: time.Now(),
+			Comment:   strings.TrimSpace(m["comment"]),
+			Tags:      extractHashTags(m["comment"]),
+			Value:     float32(value),
+			MessageID: int64(message.MessageID),
+		},
+	}
+	if isExpression(m["value"]) {
+		cmd.Entry.Expression = strings.ReplaceAll(m["value"], " ", "")
+	}
+	if message.From != nil {
+		cmd.Entry.AuthorID = int64(message.From.ID)
+	}
+	if ma, ok := getMatches(reAccount, m["comment"]); ok {
+		cmd.Entry.Account = ma["name"]
+	}
+	for _, m := range reMentions.FindAllStringSubmatch(m["comment"], -1) {
+		cmd.Split = append(cmd.Split, m[1])
+	}
+	if message.Entities != nil {
+		for _, entity := range *message.Entities {
+			if entity.Type == "text_mention" && entity.User != nil {
+				cmd.SplitIDs = append(cmd.SplitIDs, int64(entity.User.ID))
+			}
+		}
+	}
+	return cmd, nil
+}
 
-	if reTag.Match([]byte(s)) {
-		hashtags := extractHashTags(s)
-		if len(hashtags) < 2 {
-			return nil, &InvalidSyntaxError{ /*TODO: more info*/ }
+// noArgs returns parser of command without arguments
+func noArgs(cmd Command) func(p *argParser) (Command, error) {
+	return func(p *argParser) (Command, error) {
+		if err := p.end(); err != nil {
+			return nil, err
 		}
-		return &AddTagCommand{
-			SearchTag: hashtags[0],
-			Tags:      hashtags[1:],
-		}, nil
+		return cmd, nil
 	}
-	if reUntag.Match([]byte(s)) {
-		hashtags := extractHashTags(s)
-		if len(hashtags) < 1 {
-			return nil, &InvalidSyntaxError{ /*TODO: more info*/ }
+}
+
+func parseHelpCommand(p *argParser) (Command, error) {
+	cmd := &HelpCommand{}
+	if name, ok := p.word(); ok {
+		name = "/" + strings.TrimPrefix(strings.ToLower(name), "/")
+		spec, ok := commandsByName[name]
+		if !ok || spec.Admin {
+			return nil, &UnknownCommandError{Command: name, Suggestion: suggestCommand(name)}
 		}
-		return &RemoveTagCommand{
-			Tags: hashtags,
-		}, nil
+		cmd.Command = spec.Name
 	}
-	if reTags.Match([]byte(s)) {
-		return &ListTagsCommand{
-			SearchTags: extractHashTags(s),
-		}, nil
+	return cmd, p.end()
+}
+
+func parseStartCommand(p *argParser) (Command, error) {
+	cmd := &StartCommand{}
+	if code, ok := p.word(); ok {
+		if !reName.MatchString(code) {
+			return nil, &InvalidSyntaxError{Token: code}
+		}
+		cmd.Code = code
+	}
+	return cmd, p.end()
+}
+
+func parseCurrencyCommand(p *argParser) (Command, error) {
+	code, ok := p.word()
+	if !ok {
+		return nil, p.unexpected()
+	}
+	if _, err := currency.ParseISO(code); err != nil || len(code) != 3 {
+		return nil, &InvalidCurrencyError{Currency: code}
+	}
+	return &CurrencyCommand{Currency: code}, p.end()
+}
+
+func parseTimezoneCommand(p *argParser) (Command, error) {
+	name, ok := p.word()
+	if !ok {
+		return nil, p.unexpected()
 	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return nil, &InvalidTimezoneError{Timezone: name}
+	}
+	return &TimezoneCommand{Timezone: name}, p.end()
+}
 
-	if reDump.Match([]byte(s)) {
-		cmd := &DumpCommand{
-			Format: getDumpFormat(s),
-			Tags:   extractHashTags(s),
+func parseLastCommand(p *argParser) (Command, error) {
+	cmd := &LastCommand{Limit: lastDefaultLimit, Tags: make([]string, 0)}
+	if t := p.peek(); t != nil && t.Kind == tokenWord {
+		limit, ok := p.integer()
+		if !ok || limit < 1 || limit > lastMaxLimit {
+			return nil, &InvalidSyntaxError{Token: t.Value, Position: t.Pos, HasPosition: true}
 		}
-		if mp, ok := getMatches(rePeriod, s); ok {
-			sp := strings.TrimSpace(mp["period"])
-			var period int64 = 1
-			if sp != "" {
-				var err error
-				period, err = strconv.ParseInt(sp, 10, 32)
-				if err != nil {
-					return nil, &InvalidSyntaxError{ /*TODO: more info*/ }
+		cmd.Limit = limit
+	}
+	for !p.done() {
+		tag, ok := p.tag()
+		if !ok {
+			return nil, p.unexpected()
+		}
+		cmd.Tags = append(cmd.Tags, tag)
+	}
+	return cmd, nil
+}
+
+func parseFindCommand(p *argParser) (Command, error) {
+	cmd := &FindCommand{Tags: make([]string, 0), Page: 1}
+	text := make([]string, 0, len(p.tokens))
+	for !p.done() {
+		if tag, ok := p.tag(); ok {
+			cmd.Tags = append(cmd.Tags, tag)
+			continue
+		}
+		if from, ok := p.period(); ok {
+			cmd.From = from
+			continue
+		}
+		// "page" followed by number selects page of results, otherwise it is a word to search
+		if t, next := p.peek(), p.peekAt(1); t.Kind == tokenWord && strings.EqualFold(t.Value, "page") &&
+			next != nil && next.Kind == tokenWord {
+			if page, err := strconv.Atoi(next.Value); err == nil {
+				// offset of page must fit into int of any platform
+				if page < 1 || page > math.MaxInt32/findPageSize {
+					return nil, &InvalidSyntaxError{Token: next.Value, Position: next.Pos, HasPosition: true}
 				}
+				cmd.Page = page
+				p.pos += 2
+				continue
 			}
-			cmd.From = getPeriodBeginning(int(period), mp["modifier"])
 		}
-		return cmd, nil
+		t := p.next()
+		if t.Kind == tokenQuoted {
+			text = append(text, t.Value)
+		} else {
+			text = append(text, t.String())
+		}
+	}
+	cmd.Text = strings.Join(text, " ")
+	if cmd.Text == "" {
+		return nil, &InvalidSyntaxError{}
+	}
+	return cmd, nil
+}
+
+func parseChartCommand(p *argParser) (Command, error) {
+	cmd := &ChartCommand{Kind: "pie", Group: "day", Tags: make([]string, 0)}
+	for !p.done() {
+		if kind, ok := p.keyword("pie", "bar"); ok {
+			cmd.Kind = kind
+		} else if _, ok := p.keyword("by"); ok {
+			group, ok := p.keyword("day", "week", "month")
+			if !ok {
+				return nil, p.unexpected()
+			}
+			cmd.Group = group
+		} else if from, ok := p.period(); ok {
+			cmd.From = from
+		} else if tag, ok := p.tag(); ok {
+			cmd.Tags = append(cmd.Tags, tag)
+		} else {
+			return nil, p.unexpected()
+		}
+	}
+	return cmd, nil
+}
+
+func parseReportCommand(p *argParser) (Command, error) {
+	period, ok := p.keyword("weekly", "monthly", "off")
+	if !ok {
+		return nil, p.unexpected()
+	}
+	if period == "off" {
+		period = ""
+	}
+	return &ReportCommand{Period: period}, p.end()
+}
+
+func parseDumpCommand(p *argParser) (Command, error) {
+	cmd := &DumpCommand{Format: "csv", Tags: make([]string, 0)}
+	format := false
+	for !p.done() {
+		if from, ok := p.period(); ok {
+			cmd.From = from
+		} else if tag, ok := p.tag(); ok {
+			cmd.Tags = append(cmd.Tags, tag)
+		} else if word, ok := p.word(); ok && !format {
+			// formats are registered by dumpers, unknown one is reported by bot
+			cmd.Format = strings.ToLower(word)
+			format = true
+		} else {
+			if ok {
+				p.pos--
+			}
+			return nil, p.unexpected()
+		}
+	}
+	return cmd, nil
+}
+
+func parseListTagsCommand(p *argParser) (Command, error) {
+	tags, err := p.tags()
+	if err != nil {
+		return nil, err
+	}
+	return &ListTagsCommand{SearchTags: tags}, nil
+}
+
+func parseAddTagCommand(p *argParser) (Command, error) {
+	tags, err := p.tags()
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) < 2 {
+		return nil, &InvalidSyntaxError{}
+	}
+	return &AddTagCommand{SearchTag: tags[0], Tags: tags[1:]}, nil
+}
+
+func parseRemoveTagCommand(p *argParser) (Command, error) {
+	tags, err := p.tags()
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) < 1 {
+		return nil, &InvalidSyntaxError{}
+	}
+	return &RemoveTagCommand{Tags: tags}, nil
+}
+
+func parseRenameCommand(p *argParser) (Command, error) {
+	tags, err := p.tags()
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) != 2 {
+		return nil, &InvalidSyntaxError{}
+	}
+	return &MergeTagsCommand{Tags: tags[:1], Into: tags[1]}, nil
+}
+
+func parseMergeCommand(p *argParser) (Command, error) {
+	tags, err := p.tags()
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) < 2 {
+		return nil, &InvalidSyntaxError{}
+	}
+	return &MergeTagsCommand{Tags: tags[:len(tags)-1], Into: tags[len(tags)-1]}, nil
+}
+
+func parseRuleCommand(p *argParser) (Command, error) {
+	if action, ok := p.keyword("delete", "apply"); ok {
+		id, ok := p.integer()
+		if !ok {
+			return nil, p.unexpected()
+		}
+		if err := p.end(); err != nil {
+			return nil, err
+		}
+		if action == "delete" {
+			return &DeleteRuleCommand{ID: strconv.Itoa(id)}, nil
+		}
+		return &ApplyRuleCommand{ID: strconv.Itoa(id)}, nil
+	}
+	t := p.next()
+	if t == nil || (t.Kind != tokenQuoted && t.Kind != tokenRegexp) || t.Value == "" {
+		p.pos--
+		return nil, p.unexpected()
+	}
+	rule := Rule{Pattern: t.Value}
+	if t.Kind == tokenRegexp {
+		if _, err := regexp.Compile(t.Value); err != nil {
+			return nil, &InvalidSyntaxError{Token: t.String(), Position: t.Pos, HasPosition: true}
+		}
+		rule.Regexp = true
+	}
+	tags, err := p.tags()
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) < 1 {
+		return nil, &InvalidSyntaxError{}
+	}
+	rule.Tags = tags
+	return &AddRuleCommand{Rule: rule}, nil
+}
+
+func parseAddAccountCommand(p *argParser) (Command, error) {
+	if _, ok := p.keyword("add"); !ok {
+		return nil, p.unexpected()
+	}
+	name, ok := p.word()
+	if !ok || !reAccountName.MatchString(name) {
+		if ok {
+			p.pos--
+		}
+		return nil, p.unexpected()
+	}
+	code, ok := p.word()
+	if !ok {
+		return nil, p.unexpected()
 	}
+	code = strings.ToUpper(code)
+	if _, err := currency.ParseISO(code); err != nil || len(code) != 3 {
+		return nil, &InvalidCurrencyError{Currency: code}
+	}
+	cmd := &AddAccountCommand{Account: Account{Name: name, Currency: code}}
+	if !p.done() {
+		value, err := p.amount()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Value = value
+	}
+	return cmd, p.end()
+}
 
-	return nil, &UnknownCommandError{Command: s}
+func parseTransferCommand(p *argParser) (Command, error) {
+	value, err := p.amount()
+	if err != nil {
+		return nil, err
+	}
+	if value == 0 {
+		p.pos--
+		return nil, p.unexpected()
+	}
+	cmd := &TransferCommand{Value: value}
+	for _, name := range []*string{&cmd.From, &cmd.To} {
+		word, ok := p.word()
+		if !ok || !reName.MatchString(word) {
+			if ok {
+				p.pos--
+			}
+			return nil, p.unexpected()
+		}
+		*name = word
+	}
+	return cmd, p.end()
+}
+
+func parseMapAccountCommand(p *argParser) (Command, error) {
+	if p.done() {
+		return &ListMapAccountsCommand{}, nil
+	}
+	tag, ok := p.tag()
+	if !ok {
+		return nil, p.unexpected()
+	}
+	cmd := &MapAccountCommand{Tag: tag}
+	if account, ok := p.word(); ok {
+		if !reLedgerAccount.MatchString(account) {
+			p.pos--
+			return nil, p.unexpected()
+		}
+		cmd.Account = account
+	}
+	return cmd, p.end()
+}
+
+func parseMembersCommand(p *argParser) (Command, error) {
+	cmd := &MembersCommand{}
+	if from, ok := p.period(); ok {
+		cmd.From = from
+	}
+	return cmd, p.end()
+}
+
+func parseSettleCommand(p *argParser) (Command, error) {
+	t := p.next()
+	if t == nil || t.Kind != tokenMention {
+		if t != nil {
+			p.pos--
+		}
+		return nil, p.unexpected()
+	}
+	value, err := p.amount()
+	if err != nil {
+		return nil, err
+	}
+	if value == 0 {
+		p.pos--
+		return nil, p.unexpected()
+	}
+	return &SettleCommand{Name: t.Value, Value: value}, p.end()
+}
+
+func parseAdminCommand(p *argParser) (Command, error) {
+	action, ok := p.keyword("users", "stats", "enable", "disable", "broadcast")
+	if !ok {
+		return nil, p.unexpected()
+	}
+	cmd := &AdminCommand{Action: action}
+	switch action {
+	case "enable", "disable":
+		word, ok := p.word()
+		if !ok {
+			return nil, p.unexpected()
+		}
+		id, err := strconv.ParseInt(word, 10, 64)
+		if err != nil {
+			p.pos--
+			return nil, p.unexpected()
+		}
+		cmd.TelegramID = id
+	case "broadcast":
+		cmd.Text = p.rest()
+		if cmd.Text == "" {
+			return nil, &InvalidSyntaxError{}
+		}
+	}
+	return cmd, p.end()
+}
+
+func parseInviteCommand(p *argParser) (Command, error) {
+	cmd := &InviteCommand{MaxUses: 1, TTL: inviteDefaultTTL}
+	if ttl, ok := p.duration(); ok {
+		cmd.TTL = ttl
+	} else if t := p.peek(); t != nil {
+		uses, ok := p.integer()
+		if !ok || uses < 1 || uses > inviteMaxUses {
+			return nil, &InvalidSyntaxError{Token: t.Value, Position: t.Pos, HasPosition: true}
+		}
+		cmd.MaxUses = uses
+		if ttl, ok := p.duration(); ok {
+			cmd.TTL = ttl
+		}
+	}
+	return cmd, p.end()
 }
@@ -9,7 +9,33 @@ import (
 	"time"
 )
 
-var names = []string{"id", "created", "currency", "value", "comment", "tags"}
+// DumpOptions contains user settings affecting dumps
+type DumpOptions struct {
+	// Accounts maps hashtags to account names of plain text accounting tools
+	Accounts map[string]string
+}
+
+// DumpFormat writes entries into file with given extension
+type DumpFormat struct {
+	Extension string
+	Dump      func(entries []*Entry, options DumpOptions) (io.ReadCloser, error)
+}
+
+var dumpFormats = map[string]DumpFormat{
+	"csv": {
+		Extension: "csv",
+		Dump: func(entries []*Entry, _ DumpOptions) (io.ReadCloser, error) {
+			return DumpCsv(entries)
+		},
+	},
+}
+
+// RegisterDumpFormat makes dump format available for /dump command
+func RegisterDumpFormat(name string, format DumpFormat) {
+	dumpFormats[name] = format
+}
+
+var names = []string{"id", "created", "currency", "value", "comment", "tags", "author", "account"}
 
 type csvDumper struct {
 	entries []*Entry
@@ -35,6 +61,8 @@ func (d *csvDumper) Read(p []byte) (int, error) {
 		strconv.FormatFloat(float64(d.entries[d.n].Value), 'f', 4, 32),
 		d.entries[d.n].Comment,
 		strings.Join(d.entries[d.n].Tags, ","),
+		d.entries[d.n].Author,
+		d.entries[d.n].Account,
 	}
 	if err := d.csv.Write(fields); err != nil {
 		return 0, err
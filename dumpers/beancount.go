@@ -0,0 +1,49 @@
+package dumpers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	bot "github.com/borodyadka/accounting-bot"
+)
+
+// DumpBeancount writes entries as beancount transactions, all used accounts are opened at date of first entry
+func DumpBeancount(entries []*bot.Entry, options bot.DumpOptions) (io.ReadCloser, error) {
+	buff := bytes.NewBuffer(make([]byte, 0, 1024))
+	if len(entries) == 0 {
+		return ioutil.NopCloser(buff), nil
+	}
+
+	accounts := make(map[string]struct{})
+	for _, entry := range entries {
+		accounts[expenseAccount(entry, options)] = struct{}{}
+		accounts[assetAccount(entry)] = struct{}{}
+	}
+	names := make([]string, 0, len(accounts))
+	for name := range accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	opened := entries[0].CreatedAt.Format("2006-01-02")
+	for _, name := range names {
+		fmt.Fprintf(buff, "%s open %s\n", opened, name)
+	}
+	buff.WriteString("\n")
+
+	for _, entry := range entries {
+		fmt.Fprintf(
+			buff, "%s * %s\n", entry.CreatedAt.Format("2006-01-02"), beancountString(entry.Comment),
+		)
+		fmt.Fprintf(buff, "  %s  %.2f %s\n", expenseAccount(entry, options), entry.Value, entry.Currency)
+		fmt.Fprintf(buff, "  %s  %.2f %s\n\n", assetAccount(entry), -entry.Value, entry.Currency)
+	}
+	return ioutil.NopCloser(buff), nil
+}
+
+func beancountString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,62 @@
+package dumpers
+
+import (
+	"strings"
+	"unicode"
+
+	bot "github.com/borodyadka/accounting-bot"
+)
+
+const (
+	expensesRoot   = "Expenses"
+	assetsRoot     = "Assets"
+	defaultExpense = "Expenses:Unknown"
+	defaultAsset   = "Assets:Cash"
+)
+
+func init() {
+	bot.RegisterDumpFormat("ledger", bot.DumpFormat{Extension: "ledger", Dump: DumpLedger})
+	bot.RegisterDumpFormat("beancount", bot.DumpFormat{Extension: "beancount", Dump: DumpBeancount})
+}
+
+// accountName converts words to account name components like Expenses:Food:Restaurant,
+// every component starts with capital letter and contains only letters, digits and dashes
+func accountName(root string, words []string) string {
+	parts := []string{root}
+	for _, word := range words {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+				return r
+			}
+			return -1
+		}, word)
+		if word == "" {
+			continue
+		}
+		rs := []rune(word)
+		rs[0] = unicode.ToUpper(rs[0])
+		parts = append(parts, string(rs))
+	}
+	return strings.Join(parts, ":")
+}
+
+// expenseAccount returns account of entry expense, explicit mapping of tag has priority over tag itself
+func expenseAccount(entry *bot.Entry, options bot.DumpOptions) string {
+	for _, tag := range entry.Tags {
+		if account, ok := options.Accounts[tag]; ok {
+			return account
+		}
+	}
+	if len(entry.Tags) > 0 {
+		return accountName(expensesRoot, strings.Split(strings.TrimPrefix(entry.Tags[0], "#"), "/"))
+	}
+	return defaultExpense
+}
+
+// assetAccount returns account the money for entry came from
+func assetAccount(entry *bot.Entry) string {
+	if entry.Account != "" {
+		return accountName(assetsRoot, []string{entry.Account})
+	}
+	return defaultAsset
+}
@@ -0,0 +1,28 @@
+package dumpers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	bot "github.com/borodyadka/accounting-bot"
+)
+
+// DumpLedger writes entries as transactions of ledger and hledger journal
+func DumpLedger(entries []*bot.Entry, options bot.DumpOptions) (io.ReadCloser, error) {
+	buff := bytes.NewBuffer(make([]byte, 0, 1024))
+	for _, entry := range entries {
+		fmt.Fprintf(buff, "%s %s\n", entry.CreatedAt.Format("2006-01-02"), ledgerPayee(entry.Comment))
+		fmt.Fprintf(buff, "    %s  %.2f %s\n", expenseAccount(entry, options), entry.Value, entry.Currency)
+		fmt.Fprintf(buff, "    %s\n\n", assetAccount(entry))
+	}
+	return ioutil.NopCloser(buff), nil
+}
+
+// ledgerPayee makes comment a single line payee, whitespace is collapsed so comment can neither
+// start a new transaction nor turn its tail into a note which follows two spaces
+func ledgerPayee(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -2,10 +2,15 @@ package accounting_bot
 
 import (
 	"fmt"
+	"math"
+	"strings"
+	"time"
 )
 
 type UnknownCommandError struct {
 	Command string
+	// Suggestion is a known command with similar name
+	Suggestion string
 }
 
 func (e UnknownCommandError) Error() string {
@@ -13,13 +18,26 @@ func (e UnknownCommandError) Error() string {
 }
 
 func (e UnknownCommandError) String() string {
+	text := "unknown command"
 	if e.Command != "" {
-		return fmt.Sprintf(`unknown command "%s"`, e.Command)
+		text = fmt.Sprintf(`unknown command "%s"`, e.Command)
 	}
-	return "unknown command"
+	if e.Suggestion != "" {
+		text += fmt.Sprintf(", did you mean %s?", e.Suggestion)
+	}
+	return text
 }
 
 type InvalidSyntaxError struct {
+	// Command is a name of command like "/rename", empty for entries
+	Command string
+	// Token is a part of message which can not be parsed, Position is its offset in message if HasPosition is set
+	Token       string
+	Position    int
+	HasPosition bool
+	// Expected syntax and example of command
+	Expected string
+	Example  string
 }
 
 func (e InvalidSyntaxError) Error() string {
@@ -27,7 +45,25 @@ func (e InvalidSyntaxError) Error() string {
 }
 
 func (e InvalidSyntaxError) String() string {
-	return "syntax error"
+	// TODO: i18n
+	b := strings.Builder{}
+	b.WriteString("syntax error")
+	if e.Command != "" {
+		b.WriteString(" in " + e.Command)
+	}
+	if e.Token != "" {
+		b.WriteString(fmt.Sprintf(` near "%s"`, e.Token))
+		if e.HasPosition {
+			b.WriteString(fmt.Sprintf(" at position %d", e.Position+1))
+		}
+	}
+	if e.Expected != "" {
+		b.WriteString("\nusage: " + e.Expected)
+	}
+	if e.Example != "" {
+		b.WriteString("\nexample: " + e.Example)
+	}
+	return b.String()
 }
 
 type InternalError struct {
@@ -49,13 +85,18 @@ func NewInternalError(e error) *InternalError {
 	return &InternalError{Err: e}
 }
 
-type UserNotFoundError struct{}
+type UserNotFoundError struct {
+	AdminContact string
+}
 
 func (e UserNotFoundError) Error() string {
 	return e.String()
 }
 
-func (UserNotFoundError) String() string {
+func (e UserNotFoundError) String() string {
+	if e.AdminContact != "" {
+		return fmt.Sprintf("user not found or not enabled, contact %s to get access", e.AdminContact)
+	}
 	return "user not found or not enabled"
 }
 
@@ -70,6 +111,18 @@ func (e InvalidAuthCodeError) String() string {
 	return "invalid auth code"
 }
 
+// InvitesDisabledError is returned on /invite when bot is open to everyone and invites are not checked
+type InvitesDisabledError struct {
+}
+
+func (e InvitesDisabledError) Error() string {
+	return e.String()
+}
+
+func (e InvitesDisabledError) String() string {
+	return "bot is open to everyone, set AUTH_CODE or INVITE_ONLY to use invites"
+}
+
 type InvalidCurrencyError struct {
 	Currency string
 }
@@ -84,3 +137,167 @@ func (e InvalidCurrencyError) String() string {
 	}
 	return "invalid currency"
 }
+
+type RuleNotFoundError struct {
+	ID string
+}
+
+func (e RuleNotFoundError) Error() string {
+	return e.String()
+}
+
+func (e RuleNotFoundError) String() string {
+	if e.ID != "" {
+		return fmt.Sprintf(`rule "%s" not found`, e.ID)
+	}
+	return "rule not found"
+}
+
+type EntryNotFoundError struct{}
+
+func (e EntryNotFoundError) Error() string {
+	return e.String()
+}
+
+func (EntryNotFoundError) String() string {
+	return "entry not found"
+}
+
+type InvalidTimezoneError struct {
+	Timezone string
+}
+
+func (e InvalidTimezoneError) Error() string {
+	return e.String()
+}
+
+func (e InvalidTimezoneError) String() string {
+	if e.Timezone != "" {
+		return fmt.Sprintf(`invalid timezone "%s"`, e.Timezone)
+	}
+	return "invalid timezone"
+}
+
+type NotMemberError struct{}
+
+func (e NotMemberError) Error() string {
+	return e.String()
+}
+
+func (NotMemberError) String() string {
+	return "you are not a member of this ledger, send /join to become one"
+}
+
+type UnknownMemberError struct {
+	Name string
+}
+
+func (e UnknownMemberError) Error() string {
+	return e.String()
+}
+
+func (e UnknownMemberError) String() string {
+	if e.Name != "" {
+		return fmt.Sprintf(`unknown member "@%s"`, e.Name)
+	}
+	return "unknown member"
+}
+
+type NotGroupChatError struct{}
+
+func (e NotGroupChatError) Error() string {
+	return e.String()
+}
+
+func (NotGroupChatError) String() string {
+	return "this command is available only in group chats"
+}
+
+type SelfSettlementError struct{}
+
+func (e SelfSettlementError) Error() string {
+	return e.String()
+}
+
+func (SelfSettlementError) String() string {
+	return "payment to yourself can not be recorded"
+}
+
+type AccountNotFoundError struct {
+	Name string
+}
+
+func (e AccountNotFoundError) Error() string {
+	return e.String()
+}
+
+func (e AccountNotFoundError) String() string {
+	if e.Name != "" {
+		return fmt.Sprintf(`account "%s" not found`, e.Name)
+	}
+	return "account not found"
+}
+
+type AccountExistsError struct {
+	Name string
+}
+
+func (e AccountExistsError) Error() string {
+	return e.String()
+}
+
+func (e AccountExistsError) String() string {
+	return fmt.Sprintf(`account "%s" already exists`, e.Name)
+}
+
+type CurrencyMismatchError struct{}
+
+func (e CurrencyMismatchError) Error() string {
+	return e.String()
+}
+
+func (CurrencyMismatchError) String() string {
+	return "accounts have different currencies"
+}
+
+type InvalidDumpFormatError struct {
+	Format string
+}
+
+func (e InvalidDumpFormatError) Error() string {
+	return e.String()
+}
+
+func (e InvalidDumpFormatError) String() string {
+	if e.Format != "" {
+		return fmt.Sprintf(`unsupported dump format "%s"`, e.Format)
+	}
+	return "unsupported dump format"
+}
+
+type UnsupportedFileError struct {
+	Name string
+}
+
+func (e UnsupportedFileError) Error() string {
+	return e.String()
+}
+
+func (e UnsupportedFileError) String() string {
+	if e.Name != "" {
+		return fmt.Sprintf(`unsupported file "%s"`, e.Name)
+	}
+	return "unsupported file"
+}
+
+type RateLimitError struct {
+	Wait time.Duration
+}
+
+func (e RateLimitError) Error() string {
+	return e.String()
+}
+
+func (e RateLimitError) String() string {
+	return fmt.Sprintf("slow down, try again in %d seconds", int(math.Ceil(e.Wait.Seconds())))
+}
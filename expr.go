@@ -0,0 +1,140 @@
+package accounting_bot
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dates like "2021-03-01", "01/03/21" or "2021-03" look like expressions but almost certainly are not
+var reDateLike = regexp.MustCompile(`^(\d+-\d+-\d+|\d+/\d+/\d+|\d{4}-\d{1,2})$`)
+
+// EvalExpression evaluates arithmetic expression like "12.5+3*(4-1)/2" exactly and rounds result to cents,
+// only numbers, + - * / and parentheses are allowed, numbers are parsed with decimal separator of user locale.
+// Result must fit into amount of entry and input which looks like a date is rejected
+func EvalExpression(s string, decimal byte) (float64, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	if reDateLike.MatchString(s) {
+		return 0, &InvalidSyntaxError{Token: s}
+	}
+	p := &exprParser{s: s, decimal: decimal}
+	r, err := p.sum()
+	if err != nil {
+		return 0, err
+	}
+	if p.pos != len(p.s) {
+		return 0, &InvalidSyntaxError{Token: p.s[p.pos:]}
+	}
+	if new(big.Rat).Abs(r).Cmp(new(big.Rat).SetInt64(maxEntryValue)) >= 0 {
+		// TODO: i18n
+		return 0, &InvalidSyntaxError{Token: s, Expected: fmt.Sprintf("amount less than %d", int64(maxEntryValue))}
+	}
+	return strconv.ParseFloat(r.FloatString(2), 64)
+}
+
+// isExpression reports whether value is an expression rather than a plain number
+func isExpression(s string) bool {
+	return strings.ContainsAny(s, "+-*/()")
+}
+
+// exprParser is a recursive descent parser of grammar:
+//
+//	sum     = product { ("+" | "-") product }
+//	product = factor { ("*" | "/") factor }
+//	factor  = number | "(" sum ")" | "-" factor
+type exprParser struct {
+	s       string
+	pos     int
+	decimal byte
+}
+
+func (p *exprParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) sum() (*big.Rat, error) {
+	r, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		x, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		if op == '+' {
+			r.Add(r, x)
+		} else {
+			r.Sub(r, x)
+		}
+	}
+	return r, nil
+}
+
+func (p *exprParser) product() (*big.Rat, error) {
+	r, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		if op == '*' {
+			r.Mul(r, x)
+		} else {
+			if x.Sign() == 0 {
+				return nil, &InvalidSyntaxError{Token: "/0"}
+			}
+			r.Quo(r, x)
+		}
+	}
+	return r, nil
+}
+
+func (p *exprParser) factor() (*big.Rat, error) {
+	switch p.peek() {
+	case '(':
+		p.pos++
+		r, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, &InvalidSyntaxError{Token: p.s}
+		}
+		p.pos++
+		return r, nil
+	case '-':
+		p.pos++
+		r, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return r.Neg(r), nil
+	}
+	start := p.pos
+	for c := p.peek(); (c >= '0' && c <= '9') || c == '.' || c == ','; c = p.peek() {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, &InvalidSyntaxError{Token: p.s}
+	}
+	number, err := normalizeNumber(p.s[start:p.pos], p.decimal)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return nil, &InvalidSyntaxError{Token: p.s[start:p.pos]}
+	}
+	return r, nil
+}
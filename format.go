@@ -0,0 +1,27 @@
+package accounting_bot
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const tableCommentLength = 20
+
+// FormatEntriesTable renders entries as monospaced table for markdown message
+func FormatEntriesTable(entries []*Entry) string {
+	b := strings.Builder{}
+	b.WriteString("```\n")
+	for _, entry := range entries {
+		comment := strings.ReplaceAll(entry.Comment, "`", "'")
+		if utf8.RuneCountInString(comment) > tableCommentLength {
+			comment = string([]rune(comment)[:tableCommentLength-1]) + "…"
+		}
+		b.WriteString(fmt.Sprintf(
+			"%s %10.2f %s %s\n",
+			entry.CreatedAt.Format("01-02 15:04"), entry.Value, entry.Currency, comment,
+		))
+	}
+	b.WriteString("```")
+	return b.String()
+}
@@ -0,0 +1,223 @@
+package accounting_bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func isGroupChat(chat *tgbotapi.Chat) bool {
+	return chat.IsGroup() || chat.IsSuperGroup()
+}
+
+func newMember(from *tgbotapi.User) *Member {
+	name := from.UserName
+	if name == "" {
+		name = strings.TrimSpace(from.FirstName + " " + from.LastName)
+	}
+	return &Member{TelegramID: int64(from.ID), Name: name}
+}
+
+// checkMember allows only members of shared ledger to use it in group chats
+func (b *Bot) checkMember(ctx context.Context, user *User, chat *tgbotapi.Chat, from *tgbotapi.User) error {
+	if !isGroupChat(chat) {
+		return nil
+	}
+	if from == nil {
+		return &NotMemberError{}
+	}
+	member, err := b.storage.GetMember(ctx, user, int64(from.ID))
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return &NotMemberError{}
+	}
+	return nil
+}
+
+// findMembers resolves names of ledger members to their telegram ids and checks that ids belong to members,
+// members without username can be found only by id
+func (b *Bot) findMembers(ctx context.Context, user *User, names []string, ids []int64) ([]int64, error) {
+	members, err := b.storage.ListMembers(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int64, 0, len(names)+len(ids))
+	for _, id := range ids {
+		var found *Member
+		for _, member := range members {
+			if member.TelegramID == id {
+				found = member
+				break
+			}
+		}
+		if found == nil {
+			return nil, &UnknownMemberError{}
+		}
+		result = append(result, found.TelegramID)
+	}
+	for _, name := range names {
+		var found *Member
+		for _, member := range members {
+			if strings.EqualFold(member.Name, name) {
+				found = member
+				break
+			}
+		}
+		if found == nil {
+			return nil, &UnknownMemberError{Name: name}
+		}
+		result = append(result, found.TelegramID)
+	}
+	return result, nil
+}
+
+func (b *Bot) join(ctx context.Context, user *User, msg *tgbotapi.Message) error {
+	if !isGroupChat(msg.Chat) || msg.From == nil {
+		_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, "Only ledgers of group chats can be joined")) // TODO: i18n
+		return nil
+	}
+	member, err := b.storage.SaveMember(ctx, user, newMember(msg.From))
+	if err != nil {
+		return b.handleError(msg.Chat.ID, err)
+	}
+	_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s joined", member.Name))) // TODO: i18n
+	return nil
+}
+
+func FormatMembers(members []*MemberSummary) string {
+	b := strings.Builder{}
+	for _, member := range members {
+		b.WriteString(fmt.Sprintf("%s — %.2f%s (%d)\n", member.Name, member.Total, member.Currency, member.Count))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// maxExactSettlement limits number of members with debts in one currency for which the fewest transfers
+// are searched exhaustively, bigger groups are settled greedily
+const maxExactSettlement = 16
+
+// SettleDebts returns the fewest transfers required to settle balances. Members are split into the biggest
+// number of groups with zero sum of balances, each group of n members is settled with n-1 transfers,
+// in group the biggest debtors pay to the biggest creditors first
+func SettleDebts(balances []*Balance) []*Transfer {
+	byCurrency := make(map[string][]*debt)
+	currencies := make([]string, 0, 1)
+	for _, balance := range balances {
+		if _, ok := byCurrency[balance.Currency]; !ok {
+			currencies = append(currencies, balance.Currency)
+		}
+		// work in cents to avoid float rounding leftovers
+		cents := int64(math.Round(balance.Value * 100))
+		if cents == 0 {
+			continue
+		}
+		byCurrency[balance.Currency] = append(byCurrency[balance.Currency], &debt{name: balance.Name, cents: cents})
+	}
+	sort.Strings(currencies)
+
+	result := make([]*Transfer, 0, len(balances))
+	for _, currency := range currencies {
+		for _, group := range zeroSumGroups(byCurrency[currency]) {
+			for _, t := range settleGreedy(group) {
+				t.Currency = currency
+				result = append(result, t)
+			}
+		}
+	}
+	return result
+}
+
+type debt struct {
+	name  string
+	cents int64
+}
+
+// zeroSumGroups partitions members into the biggest number of groups with zero sum of balances,
+// dp[mask] is the biggest number of such groups which subset mask can be ordered into
+func zeroSumGroups(list []*debt) [][]*debt {
+	n := len(list)
+	if n == 0 {
+		return nil
+	}
+	if n > maxExactSettlement {
+		return [][]*debt{list}
+	}
+	size := 1 << n
+	sums := make([]int64, size)
+	dp := make([]int8, size)
+	for mask := 1; mask < size; mask++ {
+		low := bits.TrailingZeros(uint(mask))
+		sums[mask] = sums[mask&(mask-1)] + list[low].cents
+		best := int8(0)
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && dp[mask^(1<<i)] > best {
+				best = dp[mask^(1<<i)]
+			}
+		}
+		if sums[mask] == 0 {
+			best++
+		}
+		dp[mask] = best
+	}
+
+	// members are removed in order which keeps the number of groups, group is closed when sum becomes zero
+	groups := make([][]*debt, 0, dp[size-1])
+	group := make([]*debt, 0, n)
+	for mask := size - 1; mask != 0; {
+		closed := sums[mask] == 0
+		want := dp[mask]
+		if closed {
+			want--
+		}
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && dp[mask^(1<<i)] == want {
+				if closed && len(group) > 0 {
+					groups = append(groups, group)
+					group = make([]*debt, 0, n)
+				}
+				group = append(group, list[i])
+				mask ^= 1 << i
+				break
+			}
+		}
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// settleGreedy settles group of members with at most one transfer less than number of members
+func settleGreedy(list []*debt) []*Transfer {
+	result := make([]*Transfer, 0, len(list))
+	for {
+		sort.Slice(list, func(i, j int) bool { return list[i].cents < list[j].cents })
+		debtor, creditor := list[0], list[len(list)-1]
+		if debtor.cents >= 0 || creditor.cents <= 0 {
+			break
+		}
+		value := -debtor.cents
+		if creditor.cents < value {
+			value = creditor.cents
+		}
+		debtor.cents += value
+		creditor.cents -= value
+		result = append(result, &Transfer{From: debtor.name, To: creditor.name, Value: float64(value) / 100})
+	}
+	return result
+}
+
+func FormatTransfers(transfers []*Transfer) string {
+	b := strings.Builder{}
+	for _, t := range transfers {
+		b.WriteString(fmt.Sprintf("%s → %s %.2f%s\n", t.From, t.To, t.Value, t.Currency))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
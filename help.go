@@ -1,13 +1,82 @@
 package accounting_bot
 
-import "strings"
+import (
+	"strings"
+)
 
-var manual = `
-/help — show this help
-/dump <format> <period>
-<amount> <comment with tags>
-`
+// botCommand is an item of command menu shown by telegram clients
+type botCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// manual is generated from registry of commands
+var manual string
 
 func init() {
-	manual = strings.TrimSpace(manual)
+	b := strings.Builder{}
+	for _, spec := range commands {
+		if spec.Admin {
+			continue
+		}
+		b.WriteString("`" + spec.Usage() + "` — " + spec.Help)
+		if len(spec.Aliases) > 0 {
+			b.WriteString(" (also " + strings.Join(spec.Aliases, ", ") + ")")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("`" + entrySyntax + "` — add entry\n\n")
+	b.WriteString("Send /help <command> to see details") // TODO: i18n
+	manual = b.String()
+}
+
+// FormatCommandHelp returns detailed usage of command with example
+func FormatCommandHelp(spec *CommandSpec) string {
+	// TODO: i18n
+	b := strings.Builder{}
+	b.WriteString("`" + spec.Usage() + "`\n")
+	b.WriteString(spec.Details)
+	if len(spec.Aliases) > 0 {
+		b.WriteString("\nAliases: " + strings.Join(spec.Aliases, ", "))
+	}
+	example := spec.Example
+	if example == "" {
+		example = spec.Usage()
+	}
+	b.WriteString("\nExample: `" + example + "`")
+	return b.String()
+}
+
+// botCommands returns list of commands for command menu of telegram clients
+func botCommands() []botCommand {
+	result := make([]botCommand, 0, len(commands))
+	for _, spec := range commands {
+		if spec.Admin {
+			continue
+		}
+		result = append(result, botCommand{
+			Command:     strings.TrimPrefix(spec.Name, "/"),
+			Description: spec.Help,
+		})
+	}
+	return result
+}
+
+// suggestCommand returns known command with name closest to mistyped one like "/dupm",
+// empty string is returned when nothing is similar enough
+func suggestCommand(name string) string {
+	best, bestDistance := "", len(name)/2+1
+	if bestDistance > 3 {
+		bestDistance = 3
+	}
+	for command, spec := range commandsByName {
+		if spec.Admin {
+			continue
+		}
+		d := editDistance(name, command)
+		if d < bestDistance || (d == bestDistance && best != "" && spec.Name < best) {
+			best, bestDistance = spec.Name, d
+		}
+	}
+	return best
 }
@@ -1,8 +1,88 @@
 package accounting_bot
 
-import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+import (
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
 
 func Markdown(msg tgbotapi.MessageConfig) tgbotapi.MessageConfig {
 	msg.ParseMode = "markdown"
 	return msg
 }
+
+// markdownReplacer escapes characters having special meaning in telegram markdown
+var markdownReplacer = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// EscapeMarkdown makes user text safe to be inserted into markdown message
+func EscapeMarkdown(s string) string {
+	return markdownReplacer.Replace(s)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotModifiedError checks if telegram refused to edit message because nothing has changed,
+// only way to handle this error is compare text description
+func isNotModifiedError(err error) bool {
+	return strings.Contains(
+		err.Error(),
+		"specified new message content and reply markup are exactly the same as a current content and reply markup of the message",
+	)
+}
+
+// reTelegramDescription matches descriptions of errors returned by telegram api
+var reTelegramDescription = regexp.MustCompile(`^(Bad Request|Unauthorized|Forbidden|Not Found|Conflict|Too Many Requests)(:|$)`)
+
+// telegramErrorDescription returns description of error returned by telegram api, uploads of files return
+// description as plain error, so it is recognized by text. Errors of network and decoding are not descriptions
+func telegramErrorDescription(err error) (string, bool) {
+	if e, ok := err.(tgbotapi.Error); ok {
+		return e.Message, true
+	}
+	if err != nil && reTelegramDescription.MatchString(err.Error()) {
+		return err.Error(), true
+	}
+	return "", false
+}
+
+// isForbiddenError checks if telegram refused to send message because user blocked bot or was deleted
+func isForbiddenError(err error) bool {
+	description, ok := telegramErrorDescription(err)
+	return ok && strings.HasPrefix(description, "Forbidden:")
+}
+
+// editDistance returns Levenshtein distance between strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,440 @@
+package accounting_bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"golang.org/x/text/currency"
+)
+
+const (
+	maxImportSize = 5 << 20
+	// pending imports are dropped when not confirmed in time
+	importTTL          = time.Hour
+	importErrorsLimit  = 5
+	importFieldCreated = "created"
+	importFieldValue   = "value"
+)
+
+// layouts of dates commonly used in bank statements
+var importDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+	"01/02/2006",
+}
+
+// default layout of file is the same as DumpCsv writes
+var importDefaultLayout = map[string]string{
+	"created":  "created",
+	"currency": "currency",
+	"value":    "value",
+	"comment":  "comment",
+	"tags":     "tags",
+}
+
+// ImportFormat parses bank statement into entries using decimal separator of user locale for ambiguous amounts,
+// transactions which are not spendings are counted as skipped, ones which can not be imported are returned as errors
+type ImportFormat func(r io.Reader, currency string, decimal byte) ([]*Entry, int, []error)
+
+// import formats by file extension, csv is handled separately because of configurable layout
+var importFormats = make(map[string]ImportFormat)
+
+// RegisterImportFormat makes files with extension like ".ofx" available for import
+func RegisterImportFormat(ext string, format ImportFormat) {
+	importFormats[ext] = format
+}
+
+// isImportFile reports whether file has extension of one of import formats
+func isImportFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	_, ok := importFormats[ext]
+	return ok || ext == ".csv"
+}
+
+type ImportRowError struct {
+	Line   int
+	Reason string
+}
+
+func (e ImportRowError) Error() string {
+	return e.String()
+}
+
+func (e ImportRowError) String() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason) // TODO: i18n
+}
+
+// ParseImportLayout parses mapping of entry fields to file columns like "created=Date; value=Amount"
+func ParseImportLayout(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return importDefaultLayout, nil
+	}
+	syntaxError := func(token string) error {
+		i := strings.Index(s, token)
+		return &InvalidSyntaxError{
+			Token:       token,
+			Position:    i,
+			HasPosition: i >= 0,
+			Expected:    "created=<column>; value=<column>[; currency=<column>; comment=<column>; tags=<column>]",
+			Example:     "created=Date; value=Amount; comment=Description",
+		}
+	}
+	layout := make(map[string]string)
+	for _, pair := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' }) {
+		parts := strings.SplitN(pair, "=", 2)
+		field := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || field == "" {
+			return nil, syntaxError(pair)
+		}
+		if _, ok := importDefaultLayout[field]; !ok {
+			return nil, syntaxError(field)
+		}
+		layout[field] = strings.TrimSpace(parts[1])
+	}
+	if layout[importFieldCreated] == "" || layout[importFieldValue] == "" {
+		return nil, syntaxError("")
+	}
+	return layout, nil
+}
+
+// ValidateEntry checks that imported entry fits into storage
+func ValidateEntry(entry *Entry) error {
+	if _, err := currency.ParseISO(entry.Currency); err != nil || len(entry.Currency) != 3 {
+		return &InvalidCurrencyError{Currency: entry.Currency}
+	}
+	if entry.Value <= 0 || entry.Value >= maxEntryValue {
+		return fmt.Errorf("invalid value %.2f", entry.Value) // TODO: i18n
+	}
+	if utf8.RuneCountInString(entry.Comment) > maxCommentLength {
+		return fmt.Errorf("comment is longer than %d characters", maxCommentLength) // TODO: i18n
+	}
+	for _, tag := range entry.Tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return fmt.Errorf("tag is longer than %d characters", maxTagLength) // TODO: i18n
+		}
+	}
+	return nil
+}
+
+// ParseCsv reads entries from csv file with header, columns are found by layout, rows which can not be parsed
+// are returned as errors. Bank statements have negative values of spendings and positive values of incomes,
+// so when file has negative values its positive rows are skipped, otherwise all rows are spendings
+func ParseCsv(r io.Reader, layout map[string]string, currency string, decimal byte) ([]*Entry, int, []error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, 0, []error{&ImportRowError{Line: 1, Reason: err.Error()}}
+	}
+	columns := make(map[string]int)
+	for field, name := range layout {
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), name) {
+				columns[field] = i
+			}
+		}
+	}
+	for _, field := range []string{importFieldCreated, importFieldValue} {
+		if _, ok := columns[field]; !ok {
+			return nil, 0, []error{&ImportRowError{
+				Line: 1, Reason: fmt.Sprintf(`column "%s" not found`, layout[field]),
+			}}
+		}
+	}
+
+	entries := make([]*Entry, 0, 128)
+	// lines of entries are kept to report rows which do not fit into storage
+	lines := make([]int, 0, 128)
+	negative := false
+	errs := make([]error, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, &ImportRowError{Line: line, Reason: err.Error()})
+			continue
+		}
+		get := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := &Entry{Currency: currency, Tags: make([]string, 0)}
+		if entry.CreatedAt, err = parseImportDate(get(importFieldCreated)); err != nil {
+			errs = append(errs, &ImportRowError{
+				Line: line, Reason: fmt.Sprintf(`invalid date "%s"`, get(importFieldCreated)),
+			})
+			continue
+		}
+		value, err := ParseNumber(get(importFieldValue), decimal)
+		if err != nil || value == 0 {
+			errs = append(errs, &ImportRowError{
+				Line: line, Reason: fmt.Sprintf(`invalid value "%s"`, get(importFieldValue)),
+			})
+			continue
+		}
+		entry.Value = float32(value)
+		negative = negative || value < 0
+		if c := get("currency"); c != "" {
+			entry.Currency = strings.ToUpper(c)
+		}
+		entry.Comment = get("comment")
+		for _, tag := range strings.Split(get("tags"), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+		for _, tag := range extractHashTags(entry.Comment) {
+			if !containsString(entry.Tags, tag) {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+		entries = append(entries, entry)
+		lines = append(lines, line)
+	}
+
+	result := make([]*Entry, 0, len(entries))
+	skipped := 0
+	for i, entry := range entries {
+		if negative {
+			if entry.Value > 0 {
+				skipped++
+				continue
+			}
+			entry.Value = -entry.Value
+		}
+		if err := ValidateEntry(entry); err != nil {
+			errs = append(errs, &ImportRowError{Line: lines[i], Reason: err.Error()})
+			continue
+		}
+		result = append(result, entry)
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].(*ImportRowError).Line < errs[j].(*ImportRowError).Line
+	})
+	return result, skipped, errs
+}
+
+func parseImportDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range importDateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// FormatImportPreview describes parsed file before import, skipped are transactions which are not spendings
+func FormatImportPreview(entries []*Entry, skipped int, errs []error) string {
+	// TODO: i18n
+	b := strings.Builder{}
+	b.WriteString(fmt.Sprintf("Entries: %d, skipped: %d, errors: %d\n", len(entries), skipped, len(errs)))
+	totals := make(map[string]float32)
+	currencies := make([]string, 0, 1)
+	for _, entry := range entries {
+		if _, ok := totals[entry.Currency]; !ok {
+			currencies = append(currencies, entry.Currency)
+		}
+		totals[entry.Currency] += entry.Value
+	}
+	for _, c := range currencies {
+		b.WriteString(fmt.Sprintf("Total: %.2f%s\n", totals[c], c))
+	}
+	for i, err := range errs {
+		if i == importErrorsLimit {
+			b.WriteString("…\n")
+			break
+		}
+		b.WriteString(err.Error() + "\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+type pendingImport struct {
+	chatID int64
+	// uploader is telegram id of user who sent file, only they can confirm import
+	uploader  int64
+	entries   []*Entry
+	createdAt time.Time
+}
+
+// importsQueue keeps parsed files waiting for confirmation, every file has its own id passed to buttons of preview
+type importsQueue struct {
+	mu    sync.Mutex
+	items map[string]*pendingImport
+}
+
+// Put adds parsed file and returns its id
+func (q *importsQueue) Put(chatID, uploader int64, entries []*Entry) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.items == nil {
+		q.items = make(map[string]*pendingImport)
+	}
+	for id, item := range q.items {
+		if time.Since(item.createdAt) > importTTL {
+			delete(q.items, id)
+		}
+	}
+	id := newCorrelationID()
+	q.items[id] = &pendingImport{chatID: chatID, uploader: uploader, entries: entries, createdAt: time.Now()}
+	return id
+}
+
+// Take removes pending import and returns its entries, imports of other chats and uploaders are not taken
+func (q *importsQueue) Take(id string, chatID, uploader int64) ([]*Entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok || item.chatID != chatID {
+		return nil, true
+	}
+	if item.uploader != uploader {
+		return nil, false
+	}
+	delete(q.items, id)
+	if time.Since(item.createdAt) > importTTL {
+		return nil, true
+	}
+	return item.entries, true
+}
+
+func importKeyboard(id string) tgbotapi.InlineKeyboardMarkup {
+	// TODO: i18n
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Import", EncodeCallback(callbackImportConfirm, id)),
+		tgbotapi.NewInlineKeyboardButtonData("Cancel", EncodeCallback(callbackImportCancel, id)),
+	))
+}
+
+func (b *Bot) handleImport(ctx context.Context, user *User, msg *tgbotapi.Message, cmd *ImportCommand) error {
+	ext := strings.ToLower(path.Ext(cmd.FileName))
+	format := importFormats[ext]
+	if !isImportFile(cmd.FileName) || cmd.FileSize > maxImportSize {
+		return b.handleError(msg.Chat.ID, &UnsupportedFileError{Name: cmd.FileName})
+	}
+	var layout map[string]string
+	if ext == ".csv" {
+		var err error
+		if layout, err = ParseImportLayout(cmd.Layout); err != nil {
+			return b.handleError(msg.Chat.ID, err)
+		}
+	}
+	rules, err := b.storage.ListRules(ctx, user)
+	if err != nil {
+		return b.handleError(msg.Chat.ID, err)
+	}
+	data, err := b.downloadFile(ctx, cmd.FileID)
+	if err != nil {
+		return b.handleError(msg.Chat.ID, err)
+	}
+
+	var decimal byte
+	if msg.From != nil {
+		decimal = decimalSeparator(msg.From.LanguageCode)
+	}
+	var entries []*Entry
+	var skipped int
+	var errs []error
+	if ext == ".csv" {
+		entries, skipped, errs = ParseCsv(bytes.NewReader(data), layout, user.Currency, decimal)
+	} else {
+		entries, skipped, errs = format(bytes.NewReader(data), user.Currency, decimal)
+	}
+	for _, entry := range entries {
+		entry.Tags = ApplyRules(rules, entry.Comment, entry.Tags)
+	}
+	reply := tgbotapi.NewMessage(msg.Chat.ID, FormatImportPreview(entries, skipped, errs))
+	if len(entries) > 0 && msg.From != nil {
+		reply.ReplyMarkup = importKeyboard(b.imports.Put(msg.Chat.ID, int64(msg.From.ID), entries))
+	}
+	_, _ = b.send(reply)
+	return nil
+}
+
+func (b *Bot) handleImportCallback(
+	ctx context.Context, user *User, msg *tgbotapi.Message, from *tgbotapi.User, action string, args []string,
+) error {
+	if len(args) != 1 || from == nil {
+		return nil
+	}
+	entries, ok := b.imports.Take(args[0], msg.Chat.ID, int64(from.ID))
+	if !ok {
+		// somebody else pressed button in group chat
+		return nil
+	}
+	text := "Import cancelled" // TODO: i18n
+	if action == callbackImportConfirm {
+		if entries == nil {
+			text = "Import expired, send file again" // TODO: i18n
+		} else {
+			// bulk insert can take much longer than handling of usual message
+			ctx, cancel := context.WithTimeout(ContextWithLogger(context.Background(), b.log(ctx)), time.Minute)
+			defer cancel()
+			n, err := b.storage.ImportEntries(ctx, user, entries)
+			if err != nil {
+				return b.handleError(msg.Chat.ID, err)
+			}
+			text = fmt.Sprintf("Imported %d entries, duplicates skipped: %d", n, len(entries)-n) // TODO: i18n
+		}
+	}
+	if _, err := b.send(tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, text)); err != nil &&
+		!isNotModifiedError(err) {
+		return b.handleError(msg.Chat.ID, err)
+	}
+	return nil
+}
+
+// downloadFile reads file sent to bot, files bigger than maxImportSize are rejected
+func (b *Bot) downloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	link, err := b.api.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewInternalError(fmt.Errorf("unexpected status %s", resp.Status))
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportSize {
+		return nil, &UnsupportedFileError{}
+	}
+	return data, nil
+}
@@ -0,0 +1,11 @@
+package importers
+
+import (
+	bot "github.com/borodyadka/accounting-bot"
+)
+
+func init() {
+	bot.RegisterImportFormat(".ofx", ParseOfx)
+	bot.RegisterImportFormat(".qfx", ParseOfx)
+	bot.RegisterImportFormat(".qif", ParseQif)
+}
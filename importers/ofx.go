@@ -0,0 +1,108 @@
+package importers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	bot "github.com/borodyadka/accounting-bot"
+)
+
+var (
+	reOfxTransaction = regexp.MustCompile(`(?is)<STMTTRN>(.*?)(</STMTTRN>|<STMTTRN>|</BANKTRANLIST>)`)
+	// values of both sgml (OFX 1.x) and xml (OFX 2.x) elements end with next tag or line break
+	reOfxField    = regexp.MustCompile(`(?i)<(\w+)>([^<\r\n]*)`)
+	reOfxCurrency = regexp.MustCompile(`(?i)<CURDEF>([A-Z]{3})`)
+	reOfxAccount  = regexp.MustCompile(`(?i)<ACCTID>([^<\r\n]*)`)
+)
+
+// ParseOfx parses OFX and QFX statements, only debit transactions are imported. FITID of transaction is unique
+// only within bank account, so external id of entry is prefixed with ACCTID of statement
+func ParseOfx(r io.Reader, currency string, decimal byte) ([]*bot.Entry, int, []error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, []error{err}
+	}
+	s := string(data)
+	if m := reOfxCurrency.FindStringSubmatch(s); m != nil {
+		currency = strings.ToUpper(m[1])
+	}
+
+	// file may contain statements of several accounts, transaction belongs to the nearest preceding ACCTID
+	accounts := reOfxAccount.FindAllStringSubmatchIndex(s, -1)
+	transactions := reOfxTransaction.FindAllStringSubmatchIndex(s, -1)
+	entries := make([]*bot.Entry, 0, len(transactions))
+	skipped := 0
+	errs := make([]error, 0)
+	account := ""
+	// errors refer to line of file where transaction begins, lines are counted from the previous transaction
+	line, counted := 1, 0
+	for _, transaction := range transactions {
+		line += strings.Count(s[counted:transaction[0]], "\n")
+		counted = transaction[0]
+		for len(accounts) > 0 && accounts[0][0] < transaction[0] {
+			account = strings.TrimSpace(s[accounts[0][2]:accounts[0][3]])
+			accounts = accounts[1:]
+		}
+		fields := make(map[string]string)
+		for _, m := range reOfxField.FindAllStringSubmatch(s[transaction[2]:transaction[3]], -1) {
+			fields[strings.ToUpper(m[1])] = strings.TrimSpace(m[2])
+		}
+
+		created, err := parseOfxDate(fields["DTPOSTED"])
+		if err != nil {
+			errs = append(errs, &bot.ImportRowError{
+				Line: line, Reason: fmt.Sprintf(`invalid date "%s"`, fields["DTPOSTED"]),
+			})
+			continue
+		}
+		value, err := bot.ParseNumber(fields["TRNAMT"], decimal)
+		if err != nil {
+			errs = append(errs, &bot.ImportRowError{
+				Line: line, Reason: fmt.Sprintf(`invalid amount "%s"`, fields["TRNAMT"]),
+			})
+			continue
+		}
+		if value >= 0 {
+			skipped++
+			continue
+		}
+
+		comment := fields["NAME"]
+		if memo := fields["MEMO"]; memo != "" && memo != comment {
+			comment = strings.TrimSpace(comment + " " + memo)
+		}
+		externalID := fields["FITID"]
+		if externalID != "" && account != "" {
+			externalID = account + ":" + externalID
+		}
+		entry := &bot.Entry{
+			CreatedAt:  created,
+			Comment:    comment,
+			Tags:       make([]string, 0),
+			Currency:   currency,
+			Value:      float32(-value),
+			ExternalID: externalID,
+		}
+		if err := bot.ValidateEntry(entry); err != nil {
+			errs = append(errs, &bot.ImportRowError{Line: line, Reason: err.Error()})
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped, errs
+}
+
+// parseOfxDate parses dates like 20210301, 20210301120000 or 20210301120000.000[-5:EST], timezone is ignored
+func parseOfxDate(s string) (time.Time, error) {
+	if len(s) >= 14 {
+		return time.Parse("20060102150405", s[:14])
+	}
+	if len(s) >= 8 {
+		return time.Parse("20060102", s[:8])
+	}
+	return time.Time{}, fmt.Errorf("invalid date %s", s)
+}
@@ -0,0 +1,104 @@
+package importers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	bot "github.com/borodyadka/accounting-bot"
+)
+
+// dates in QIF files are usually in US format with apostrophe before year like 3/ 1'21
+var qifDateLayouts = []string{"1/2/2006", "1/2/06", "2.1.2006", "2.1.06", "2006-01-02"}
+
+// errNotSpending is returned for credit transactions which are skipped
+var errNotSpending = errors.New("not a spending")
+
+// ParseQif parses QIF statements, only debit transactions are imported, QIF has no transaction ids
+func ParseQif(r io.Reader, currency string, decimal byte) ([]*bot.Entry, int, []error) {
+	scanner := bufio.NewScanner(r)
+	entries := make([]*bot.Entry, 0, 128)
+	skipped := 0
+	errs := make([]error, 0)
+
+	fields := make(map[byte]string)
+	start := 1
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || s[0] == '!' {
+			continue
+		}
+		if s[0] != '^' {
+			if len(fields) == 0 {
+				start = line
+			}
+			fields[s[0]] = strings.TrimSpace(s[1:])
+			continue
+		}
+
+		entry, err := qifEntry(fields, currency, decimal)
+		fields = make(map[byte]string)
+		if err == errNotSpending {
+			skipped++
+			continue
+		}
+		if err != nil {
+			errs = append(errs, &bot.ImportRowError{Line: start, Reason: err.Error()})
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return entries, skipped, errs
+}
+
+func qifEntry(fields map[byte]string, currency string, decimal byte) (*bot.Entry, error) {
+	created, err := parseQifDate(fields['D'])
+	if err != nil {
+		return nil, fmt.Errorf(`invalid date "%s"`, fields['D'])
+	}
+	amount := fields['T']
+	if amount == "" {
+		amount = fields['U']
+	}
+	value, err := bot.ParseNumber(amount, decimal)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid amount "%s"`, amount)
+	}
+	if value >= 0 {
+		return nil, errNotSpending
+	}
+
+	comment := fields['P']
+	if memo := fields['M']; memo != "" && memo != comment {
+		comment = strings.TrimSpace(comment + " " + memo)
+	}
+	entry := &bot.Entry{
+		CreatedAt: created,
+		Comment:   comment,
+		Tags:      make([]string, 0),
+		Currency:  currency,
+		Value:     float32(-value),
+	}
+	if err := bot.ValidateEntry(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func parseQifDate(s string) (time.Time, error) {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, " ", ""), "'", "/")
+	var err error
+	for _, layout := range qifDateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
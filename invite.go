@@ -0,0 +1,75 @@
+package accounting_bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	inviteDefaultTTL = 7 * 24 * time.Hour
+	inviteMaxUses    = 1000
+	// random bytes in invite code, it is twice as long in hex
+	inviteCodeSize = 6
+)
+
+func newInviteCode() (string, error) {
+	b := make([]byte, inviteCodeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// FormatInvite describes invite with link which starts bot with code
+func FormatInvite(invite *Invite, botName string) string {
+	// TODO: i18n
+	return fmt.Sprintf(
+		"Invite code %s can be used %d times until %s\nhttps://t.me/%s?start=%s",
+		invite.Code, invite.MaxUses, invite.ExpiresAt.Format("2006-01-02 15:04"), botName, invite.Code,
+	)
+}
+
+func (b *Bot) handleInvite(ctx context.Context, msg *tgbotapi.Message, cmd *InviteCommand) error {
+	if msg.From == nil || !b.isAdmin(int64(msg.From.ID)) {
+		return b.handleError(msg.Chat.ID, &UnknownCommandError{Command: "/invite"})
+	}
+	if b.config.AuthCode == "" && !b.config.InviteOnly {
+		return b.handleError(msg.Chat.ID, &InvitesDisabledError{})
+	}
+	code, err := newInviteCode()
+	if err != nil {
+		return b.handleError(msg.Chat.ID, NewInternalError(err))
+	}
+	invite, err := b.storage.SaveInvite(ctx, &Invite{
+		Code:      code,
+		CreatedBy: int64(msg.From.ID),
+		ExpiresAt: time.Now().Add(cmd.TTL),
+		MaxUses:   cmd.MaxUses,
+	})
+	if err != nil {
+		return b.handleError(msg.Chat.ID, err)
+	}
+	// bot names often contain underscores, so link is sent as plain text
+	_, _ = b.send(tgbotapi.NewMessage(msg.Chat.ID, FormatInvite(invite, b.api.Self.UserName)))
+	return nil
+}
+
+// inviteCode checks code sent with /start, it is either AUTH_CODE or invite which is returned to be redeemed
+// along with creation of user, bot is open to everyone when neither of them is required
+func (b *Bot) inviteCode(code string) (string, error) {
+	if b.config.AuthCode == "" && !b.config.InviteOnly {
+		return "", nil
+	}
+	if code == "" {
+		return "", &InvalidAuthCodeError{}
+	}
+	if b.config.AuthCode != "" && code == b.config.AuthCode {
+		return "", nil
+	}
+	return code, nil
+}
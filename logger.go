@@ -1,12 +1,24 @@
 package accounting_bot
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"os"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
+// formats of log output
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+type loggerContextKey struct{}
+
+// NamespaceHook adds namespace of logger as a field of every entry
 type NamespaceHook struct {
 	ns string
 }
@@ -16,13 +28,7 @@ func (h *NamespaceHook) Levels() []logrus.Level {
 }
 
 func (h *NamespaceHook) Fire(e *logrus.Entry) error {
-	b := strings.Builder{}
-	b.Grow(len(e.Message) + len(h.ns) + 3)
-	b.WriteString("(")
-	b.WriteString(h.ns)
-	b.WriteString(") ")
-	b.WriteString(e.Message)
-	e.Message = b.String()
+	e.Data["namespace"] = h.ns
 	return nil
 }
 
@@ -30,10 +36,24 @@ func NewNamespaceHook(ns string) *NamespaceHook {
 	return &NamespaceHook{ns: ns}
 }
 
-func NewLogger(level logrus.Level, namespace string) *logrus.Logger {
+// NewFormatter returns formatter of log output, format is either "text" or "json"
+func NewFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case LogFormatText, "":
+		return &logrus.TextFormatter{DisableSorting: false}, nil
+	case LogFormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf(`unknown log format "%s"`, format)
+}
+
+func NewLogger(level logrus.Level, namespace string, formatter logrus.Formatter) *logrus.Logger {
+	if formatter == nil {
+		formatter = &logrus.TextFormatter{DisableSorting: false}
+	}
 	logger := &logrus.Logger{
 		Out:       os.Stdout,
-		Formatter: &logrus.TextFormatter{DisableSorting: false},
+		Formatter: formatter,
 		Hooks:     make(logrus.LevelHooks),
 		Level:     level,
 		ExitFunc:  os.Exit,
@@ -43,3 +63,29 @@ func NewLogger(level logrus.Level, namespace string) *logrus.Logger {
 	}
 	return logger
 }
+
+// ContextWithLogger returns context carrying log entry, so everything done with this context
+// including storage calls is logged with fields of entry
+func ContextWithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, entry)
+}
+
+// LoggerFromContext returns log entry carried by ctx or entry of fallback logger
+func LoggerFromContext(ctx context.Context, fallback *logrus.Logger) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerContextKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(fallback)
+}
+
+// newCorrelationID returns random id which ties together log lines of one update
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// log returns logger of update being handled with ctx
+func (b *Bot) log(ctx context.Context) *logrus.Entry {
+	return LoggerFromContext(ctx, b.logger)
+}
@@ -0,0 +1,201 @@
+package accounting_bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "accounting_bot"
+	// health checks should not hang when database or telegram are unavailable
+	healthCheckTimeout = 3 * time.Second
+	// telegram is checked by probe only when bot has not called it successfully for a while,
+	// and is reported unavailable when there were no successful calls for longer
+	telegramCheckInterval = 30 * time.Second
+	telegramStaleAfter    = 2 * time.Minute
+)
+
+// botMetrics are collectors of bot, they are created for every bot so bots do not share registry
+type botMetrics struct {
+	updates        *prometheus.CounterVec
+	handleDuration *prometheus.HistogramVec
+	errors         *prometheus.CounterVec
+	sendFailures   prometheus.Counter
+}
+
+func newBotMetrics() *botMetrics {
+	return &botMetrics{
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "updates_total",
+			Help:      "Number of handled updates by command type.",
+		}, []string{"command"}),
+		handleDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "handle_duration_seconds",
+			Help:      "Time spent handling updates by command type.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "errors_total",
+			Help:      "Number of errors reported to users by error type.",
+		}, []string{"type"}),
+		sendFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "telegram_send_failures_total",
+			Help:      "Number of messages telegram refused to send or edit.",
+		}),
+	}
+}
+
+// register registers all collectors with registerer
+func (m *botMetrics) register(registerer prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{m.updates, m.handleDuration, m.errors, m.sendFailures} {
+		if err := registerer.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commandType returns name of command type like "DumpCommand" to be used as label of metrics
+func commandType(cmd Command) string {
+	t := reflect.TypeOf(cmd)
+	if t == nil {
+		return "unknown"
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// errorType returns name of error type from errors.go, errors of other packages have the same type "other"
+func errorType(err error) string {
+	t := reflect.TypeOf(err)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() != reflect.TypeOf(InternalError{}).PkgPath() {
+		return "other"
+	}
+	return t.Name()
+}
+
+// observeUpdate records handled update of command type
+func (m *botMetrics) observeUpdate(command string, started time.Time) {
+	m.updates.WithLabelValues(command).Inc()
+	m.handleDuration.WithLabelValues(command).Observe(time.Since(started).Seconds())
+}
+
+// send sends message and counts failures, refusal to edit message which is not modified is not a failure
+func (b *Bot) send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg, err := b.api.Send(c)
+	b.telegram.observe(err)
+	if err != nil && !isNotModifiedError(err) {
+		b.metrics.sendFailures.Inc()
+	}
+	return msg, err
+}
+
+// telegramHealth remembers results of calls to telegram, so probes do not wait for telegram
+type telegramHealth struct {
+	mu       sync.Mutex
+	lastOK   time.Time
+	lastErr  error
+	checking bool
+}
+
+// observe records result of call, errors returned by telegram itself mean it is reachable
+func (h *telegramHealth) observe(err error) {
+	if _, ok := telegramErrorDescription(err); ok {
+		err = nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = err
+	if err == nil {
+		h.lastOK = time.Now()
+	}
+}
+
+// check reports result of recent calls and refreshes it in background when it is getting stale
+func (h *telegramHealth) check(refresh func()) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.lastOK) > telegramCheckInterval && !h.checking {
+		h.checking = true
+		go func() {
+			refresh()
+			h.mu.Lock()
+			h.checking = false
+			h.mu.Unlock()
+		}()
+	}
+	if time.Since(h.lastOK) <= telegramStaleAfter {
+		return nil
+	}
+	if h.lastErr != nil {
+		return h.lastErr
+	}
+	return fmt.Errorf("no successful calls since %s", h.lastOK.Format(time.RFC3339))
+}
+
+// Handler returns http handler with metrics in prometheus format, liveness and readiness probes
+func (b *Bot) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		// bot is alive once it has connected to telegram
+		select {
+		case <-b.startedC:
+			_, _ = fmt.Fprintln(w, "ok")
+		default:
+			http.Error(w, "not started", http.StatusServiceUnavailable)
+		}
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := b.checkReady(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// checkReady verifies that repository and telegram are reachable
+func (b *Bot) checkReady(ctx context.Context) error {
+	select {
+	case <-b.startedC:
+	default:
+		return fmt.Errorf("not started")
+	}
+	if b.backgroundCtx.Err() != nil {
+		return fmt.Errorf("stopped")
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := b.storage.Ping(ctx); err != nil {
+		return fmt.Errorf("repository: %w", err)
+	}
+	// tgbotapi does not support context and waits for timeout of its http client, so probe is answered
+	// with result of recent calls while telegram is checked in background
+	err := b.telegram.check(func() {
+		_, err := b.api.GetMe()
+		b.telegram.observe(err)
+	})
+	if err != nil {
+		return fmt.Errorf("telegram: %w", err)
+	}
+	return nil
+}
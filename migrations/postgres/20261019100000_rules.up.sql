@@ -0,0 +1,10 @@
+CREATE TABLE rules
+(
+    "id"         BIGSERIAL                              NOT NULL PRIMARY KEY,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    "user_id"    BIGINT                                 NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "pattern"    VARCHAR(250)                           NOT NULL,
+    "regexp"     BOOLEAN                  DEFAULT FALSE NOT NULL,
+    "tags"       VARCHAR(128)[]           DEFAULT '{}'  NOT NULL
+);
+CREATE INDEX i_rules_user_id ON rules ("user_id");
@@ -0,0 +1 @@
+DROP INDEX i_entries_comment_search;
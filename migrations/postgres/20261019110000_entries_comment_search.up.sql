@@ -0,0 +1 @@
+CREATE INDEX i_entries_comment_search ON entries USING GIN (to_tsvector('simple', "comment"));
@@ -0,0 +1,3 @@
+ALTER TABLE entries DROP COLUMN "author_id";
+
+DROP TABLE members;
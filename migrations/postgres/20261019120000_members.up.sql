@@ -0,0 +1,11 @@
+CREATE TABLE members
+(
+    "id"          BIGSERIAL                              NOT NULL PRIMARY KEY,
+    "created_at"  TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    "user_id"     BIGINT                                 NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "telegram_id" BIGINT                                 NOT NULL,
+    "name"        VARCHAR(128)             DEFAULT ''    NOT NULL
+);
+CREATE UNIQUE INDEX u_members_telegram_id ON members ("user_id", "telegram_id");
+
+ALTER TABLE entries ADD COLUMN "author_id" BIGINT DEFAULT NULL;
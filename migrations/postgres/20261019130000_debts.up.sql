@@ -0,0 +1,13 @@
+CREATE TABLE debts
+(
+    "id"          BIGSERIAL                              NOT NULL PRIMARY KEY,
+    "created_at"  TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    "user_id"     BIGINT                                 NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "entry_id"    BIGINT                   DEFAULT NULL REFERENCES "entries" ("id") ON DELETE CASCADE,
+    "debtor_id"   BIGINT                                 NOT NULL,
+    "creditor_id" BIGINT                                 NOT NULL,
+    "currency"    CHAR(3)                                NOT NULL,
+    "value"       DECIMAL(10, 2)                         NOT NULL
+);
+CREATE INDEX i_debts_user_id ON debts ("user_id");
+CREATE INDEX i_debts_entry_id ON debts ("entry_id");
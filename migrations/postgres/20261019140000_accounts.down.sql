@@ -0,0 +1,4 @@
+ALTER TABLE entries DROP COLUMN "account_id";
+
+DROP TABLE transfers;
+DROP TABLE accounts;
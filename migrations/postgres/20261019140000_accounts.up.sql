@@ -0,0 +1,24 @@
+CREATE TABLE accounts
+(
+    "id"         BIGSERIAL                              NOT NULL PRIMARY KEY,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    "user_id"    BIGINT                                 NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "name"       VARCHAR(64)                            NOT NULL,
+    "currency"   CHAR(3)                                NOT NULL
+);
+CREATE UNIQUE INDEX u_accounts_name ON accounts ("user_id", "name");
+
+CREATE TABLE transfers
+(
+    "id"              BIGSERIAL                              NOT NULL PRIMARY KEY,
+    "created_at"      TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    "user_id"         BIGINT                                 NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "from_account_id" BIGINT                   DEFAULT NULL REFERENCES "accounts" ("id") ON DELETE CASCADE,
+    "to_account_id"   BIGINT                                 NOT NULL REFERENCES "accounts" ("id") ON DELETE CASCADE,
+    "value"           DECIMAL(10, 2)                         NOT NULL
+);
+CREATE INDEX i_transfers_from_account_id ON transfers ("from_account_id");
+CREATE INDEX i_transfers_to_account_id ON transfers ("to_account_id");
+
+ALTER TABLE entries ADD COLUMN "account_id" BIGINT DEFAULT NULL REFERENCES "accounts" ("id") ON DELETE SET NULL;
+CREATE INDEX i_entries_account_id ON entries ("account_id");
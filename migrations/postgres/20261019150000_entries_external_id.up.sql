@@ -0,0 +1,2 @@
+ALTER TABLE entries ADD COLUMN "external_id" VARCHAR(255) DEFAULT NULL;
+CREATE UNIQUE INDEX u_entries_external_id ON entries ("user_id", "external_id");
@@ -0,0 +1 @@
+ALTER TABLE entries ADD COLUMN "expression" VARCHAR(255) DEFAULT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE invites
+(
+    "id"         BIGSERIAL                              NOT NULL PRIMARY KEY,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    "created_by" BIGINT                                 NOT NULL,
+    "code"       VARCHAR(64)                            NOT NULL,
+    "expires_at" TIMESTAMP WITH TIME ZONE               NOT NULL,
+    "max_uses"   INTEGER                  DEFAULT 1     NOT NULL,
+    "uses"       INTEGER                  DEFAULT 0     NOT NULL
+);
+CREATE UNIQUE INDEX u_invites_code ON invites ("code");
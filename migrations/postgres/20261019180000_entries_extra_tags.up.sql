@@ -0,0 +1 @@
+ALTER TABLE entries ADD COLUMN "extra_tags" VARCHAR(128)[] NOT NULL DEFAULT '{}';
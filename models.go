@@ -3,10 +3,18 @@ package accounting_bot
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"regexp"
 	"time"
 )
 
-type Features struct{}
+type Features struct {
+	// Report is a period of scheduled summary report: weekly, monthly or empty when disabled
+	Report       string    `json:"report,omitempty"`
+	ReportSentAt time.Time `json:"report_sent_at"`
+	Timezone     string    `json:"timezone,omitempty"`
+	// Accounts maps hashtags to account names used in ledger and beancount dumps
+	Accounts map[string]string `json:"accounts,omitempty"`
+}
 
 func (f Features) Value() (driver.Value, error) {
 	return json.Marshal(f)
@@ -26,6 +34,49 @@ type User struct {
 	Features   Features
 }
 
+// UserSummary describes activity of user for admins
+type UserSummary struct {
+	User        User
+	Entries     int
+	LastEntryAt time.Time
+}
+
+// Stats describes usage of bot for admins
+type Stats struct {
+	Users        int
+	EnabledUsers int
+	// ActiveUsers have added or changed entries recently
+	ActiveUsers int
+	Entries     int
+}
+
+// Invite allows to start using private bot, it can be used limited number of times before expiration
+type Invite struct {
+	ID        string
+	Code      string
+	CreatedBy int64 // telegram id of admin
+	ExpiresAt time.Time
+	MaxUses   int
+	Uses      int
+}
+
+// Location returns user timezone, UTC by default
+func (u *User) Location() *time.Location {
+	if u.Features.Timezone != "" {
+		if loc, err := time.LoadLocation(u.Features.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// limits of entry fields in storage
+const (
+	maxEntryValue    = 1e8
+	maxCommentLength = 250
+	maxTagLength     = 128
+)
+
 type Entry struct {
 	ID        string
 	CreatedAt time.Time
@@ -33,6 +84,91 @@ type Entry struct {
 	Tags      []string
 	Currency  string
 	Value     float32
-	MessageID int64
-	ReplyID   int64 // bot reply message id
+	// Expression is an arithmetic expression which value was calculated from, like "12.5+3.2"
+	Expression string
+	MessageID  int64
+	ReplyID    int64 // bot reply message id
+	AuthorID   int64 // telegram id of user who sent message
+	Author     string
+	AccountID  string
+	Account    string
+	// ExternalID is an id of imported bank transaction
+	ExternalID string
+}
+
+// Account is a source of money like card or cash
+type Account struct {
+	ID       string
+	Name     string
+	Currency string
+	Balance  float32
+}
+
+// Member is a participant of shared ledger of group chat
+type Member struct {
+	ID         string
+	TelegramID int64
+	Name       string
+}
+
+// Balance is a net amount lent (positive) or borrowed (negative) by ledger member,
+// values of debts are summed for all time, so they are kept in float64 to stay exact up to cents
+type Balance struct {
+	TelegramID int64
+	Name       string
+	Currency   string
+	Value      float64
+}
+
+// Transfer is a payment required to settle debts
+type Transfer struct {
+	From     string
+	To       string
+	Currency string
+	Value    float64
+}
+
+// MemberSummary contains spendings of ledger member in one currency
+type MemberSummary struct {
+	Name     string
+	Currency string
+	Count    int
+	Total    float32
+}
+
+// Rule adds tags to entries which comments contain keyword or match regular expression
+type Rule struct {
+	ID      string
+	Pattern string
+	Regexp  bool
+	Tags    []string
+	// re is compiled Pattern of regexp rule
+	re *regexp.Regexp
+}
+
+// TagSummary contains usage of tag and all of its subtags in one currency
+type TagSummary struct {
+	Tag      string
+	Currency string
+	Count    int
+	Total    float32
+}
+
+// PeriodSummary contains spendings in one currency during period beginning at Start
+type PeriodSummary struct {
+	Start    time.Time
+	Currency string
+	Count    int
+	Total    float32
+}
+
+// Summary contains spendings in user's currency during period
+type Summary struct {
+	From     time.Time
+	To       time.Time
+	Currency string
+	Count    int
+	Total    float32
+	Tags     []*TagSummary
+	Entries  []*Entry
 }
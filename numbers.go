@@ -0,0 +1,109 @@
+package accounting_bot
+
+import (
+	"strconv"
+	"strings"
+)
+
+// languages which use comma as decimal separator
+var commaDecimalLanguages = []string{
+	"be", "bg", "cs", "da", "de", "el", "es", "et", "fi", "fr", "hr", "hu", "id", "it", "kk", "lt", "lv", "nl",
+	"no", "pl", "pt", "ro", "ru", "sk", "sl", "sr", "sv", "tr", "uk", "uz",
+}
+
+// decimalSeparator returns decimal separator used in language like "ru" or "en-US",
+// zero is returned when language is unknown
+func decimalSeparator(languageCode string) byte {
+	if languageCode == "" {
+		return 0
+	}
+	lang := strings.ToLower(strings.SplitN(languageCode, "-", 2)[0])
+	if containsString(commaDecimalLanguages, lang) {
+		return ','
+	}
+	return '.'
+}
+
+// normalizeNumber converts number like "1 200,50" or "1,200.50" to "1200.50",
+// separator followed by exactly three digits is ambiguous and resolved by decimal separator of user locale
+func normalizeNumber(s string, decimal byte) (string, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	dot, comma := strings.Count(s, "."), strings.Count(s, ",")
+	switch {
+	case dot == 0 && comma == 0:
+		return s, nil
+	case dot > 0 && comma > 0:
+		// last separator is decimal, other one groups thousands
+		sep, group := byte('.'), ","
+		if strings.LastIndexByte(s, ',') > strings.LastIndexByte(s, '.') {
+			sep, group = ',', "."
+		}
+		if strings.Count(s, string(sep)) > 1 {
+			return "", &InvalidSyntaxError{Token: s}
+		}
+		i := strings.IndexByte(s, sep)
+		integer, fraction := s[:i], s[i+1:]
+		if !isGrouped(integer, group) {
+			return "", &InvalidSyntaxError{Token: s}
+		}
+		return strings.ReplaceAll(integer, group, "") + "." + fraction, nil
+	}
+
+	sep := "."
+	if comma > 0 {
+		sep = ","
+	}
+	if dot+comma > 1 {
+		// only thousands can be separated more than once
+		if !isGrouped(s, sep) {
+			return "", &InvalidSyntaxError{Token: s}
+		}
+		return strings.ReplaceAll(s, sep, ""), nil
+	}
+	i := strings.Index(s, sep)
+	if len(s)-i-1 == 3 && i > 0 && i <= 3 {
+		switch decimal {
+		case 0:
+			// e.g. "1,200" is either 1200 or 1.2
+			fraction, _ := strconv.ParseFloat(s[:i]+"."+s[i+1:], 64)
+			return "", &InvalidSyntaxError{
+				Token:    s,
+				Expected: s[:i] + s[i+1:] + " or " + strconv.FormatFloat(fraction, 'f', -1, 64),
+			}
+		case sep[0]:
+			return s[:i] + "." + s[i+1:], nil
+		default:
+			return s[:i] + s[i+1:], nil
+		}
+	}
+	return s[:i] + "." + s[i+1:], nil
+}
+
+// ParseNumber parses signed number like "-1 200,50", decimal separator is used for ambiguous numbers like "1,200"
+// and may be zero when it is unknown
+func ParseNumber(s string, decimal byte) (float64, error) {
+	s = strings.TrimSpace(s)
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		sign, s = s[:1], strings.TrimSpace(s[1:])
+	}
+	number, err := normalizeNumber(s, decimal)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(sign+number, 64)
+}
+
+// isGrouped reports whether digits are separated by groups of three like "1,200,000"
+func isGrouped(s, sep string) bool {
+	groups := strings.Split(s, sep)
+	if len(groups[0]) == 0 || len(groups[0]) > 3 {
+		return false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,278 @@
+package accounting_bot
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// kinds of tokens in arguments of command
+const (
+	tokenWord = iota
+	tokenTag
+	tokenMention
+	tokenQuoted
+	tokenRegexp
+)
+
+// maxPeriodCount limits number of units in period like "3 months", so beginning of period stays a sane date
+const maxPeriodCount = 10000
+
+// units of periods like "3 months"
+var periodUnits = []string{"year", "years", "month", "months", "week", "weeks", "day", "days", "hour", "hours"}
+
+type token struct {
+	Kind  int
+	Value string
+	// Pos is an offset of token in message
+	Pos int
+}
+
+// String returns token as it was written in message
+func (t token) String() string {
+	switch t.Kind {
+	case tokenMention:
+		return "@" + t.Value
+	case tokenQuoted:
+		return `"` + t.Value + `"`
+	case tokenRegexp:
+		return "/" + t.Value + "/"
+	}
+	return t.Value
+}
+
+// tokenize splits arguments of command into words, #tags, @mentions, "quoted strings" and /regular expressions/,
+// offset is a position of arguments in message
+func tokenize(s string, offset int) ([]token, error) {
+	tokens := make([]token, 0, 8)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+		switch r {
+		case '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, &InvalidSyntaxError{Token: s[i:], Position: offset + i, HasPosition: true}
+			}
+			tokens = append(tokens, token{Kind: tokenQuoted, Value: s[i+1 : i+1+end], Pos: offset + i})
+			i += end + 2
+			continue
+		case '/':
+			// regular expression ends with slash followed by space or end of message
+			if end := regexpEnd(s, i+1); end > 0 {
+				tokens = append(tokens, token{Kind: tokenRegexp, Value: s[i+1 : end], Pos: offset + i})
+				i = end + 1
+				continue
+			}
+		}
+		end := strings.IndexFunc(s[i:], unicode.IsSpace)
+		if end < 0 {
+			end = len(s) - i
+		}
+		t := token{Kind: tokenWord, Value: s[i : i+end], Pos: offset + i}
+		if reHashTags.FindString(t.Value) == t.Value {
+			t.Kind = tokenTag
+		} else if m := reMentions.FindStringSubmatch(t.Value); m != nil && m[0] == t.Value {
+			t.Kind, t.Value = tokenMention, m[1]
+		}
+		tokens = append(tokens, t)
+		i += end
+	}
+	return tokens, nil
+}
+
+func regexpEnd(s string, from int) int {
+	for j := from; j < len(s); j++ {
+		if s[j] == '/' && j > from && (j+1 == len(s) || s[j+1] == ' ' || s[j+1] == '\t' || s[j+1] == '\n') {
+			return j
+		}
+	}
+	return -1
+}
+
+// argParser consumes tokens of command arguments
+type argParser struct {
+	tokens []token
+	pos    int
+	// source is a message tokens are taken from
+	source string
+	// decimal separator of user locale
+	decimal byte
+}
+
+func (p *argParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *argParser) peek() *token {
+	if p.done() {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+// peekAt returns token which is offset tokens ahead of current one without consuming anything
+func (p *argParser) peekAt(offset int) *token {
+	if p.pos+offset >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos+offset]
+}
+
+func (p *argParser) next() *token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+// unexpected returns syntax error pointing to current token, or to end of message if all tokens are consumed
+func (p *argParser) unexpected() error {
+	t := p.peek()
+	if t == nil {
+		return &InvalidSyntaxError{}
+	}
+	return &InvalidSyntaxError{Token: t.String(), Position: t.Pos, HasPosition: true}
+}
+
+// end returns error if not all arguments are consumed
+func (p *argParser) end() error {
+	if !p.done() {
+		return p.unexpected()
+	}
+	return nil
+}
+
+// rest consumes all remaining arguments and returns them as they were written
+func (p *argParser) rest() string {
+	t := p.peek()
+	if t == nil {
+		return ""
+	}
+	p.pos = len(p.tokens)
+	return strings.TrimSpace(p.source[t.Pos:])
+}
+
+// keyword consumes word if it is one of words, matching is case insensitive
+func (p *argParser) keyword(words ...string) (string, bool) {
+	t := p.peek()
+	if t == nil || t.Kind != tokenWord {
+		return "", false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.Value, word) {
+			p.pos++
+			return word, true
+		}
+	}
+	return "", false
+}
+
+// word consumes any word
+func (p *argParser) word() (string, bool) {
+	t := p.peek()
+	if t == nil || t.Kind != tokenWord {
+		return "", false
+	}
+	p.pos++
+	return t.Value, true
+}
+
+// integer consumes positive integer number which fits into int32
+func (p *argParser) integer() (int, bool) {
+	t := p.peek()
+	if t == nil || t.Kind != tokenWord {
+		return 0, false
+	}
+	n, err := strconv.Atoi(t.Value)
+	if err != nil || n < 0 || n > math.MaxInt32 {
+		return 0, false
+	}
+	p.pos++
+	return n, true
+}
+
+// tag consumes hashtag
+func (p *argParser) tag() (string, bool) {
+	t := p.peek()
+	if t == nil || t.Kind != tokenTag {
+		return "", false
+	}
+	p.pos++
+	return t.Value, true
+}
+
+// tags consumes all arguments which must be hashtags
+func (p *argParser) tags() ([]string, error) {
+	tags := make([]string, 0, len(p.tokens))
+	for !p.done() {
+		tag, ok := p.tag()
+		if !ok {
+			return nil, p.unexpected()
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// amount consumes number or arithmetic expression written with decimal separator of user locale
+func (p *argParser) amount() (float32, error) {
+	t := p.peek()
+	if t == nil || t.Kind != tokenWord {
+		return 0, p.unexpected()
+	}
+	value, err := EvalExpression(t.Value, p.decimal)
+	if err != nil {
+		return 0, err
+	}
+	if value < 0 {
+		return 0, p.unexpected()
+	}
+	p.pos++
+	return float32(value), nil
+}
+
+// period consumes period like "3 months" or "week" and returns its beginning
+func (p *argParser) period() (time.Time, bool) {
+	n := 1
+	start := p.pos
+	if v, ok := p.integer(); ok {
+		n = v
+	}
+	unit, ok := p.keyword(periodUnits...)
+	if !ok || n > maxPeriodCount {
+		p.pos = start
+		return time.Time{}, false
+	}
+	return getPeriodBeginning(n, unit), true
+}
+
+// duration consumes period like "3 days" and returns its length, months and years are approximate
+func (p *argParser) duration() (time.Duration, bool) {
+	start := p.pos
+	n, ok := p.integer()
+	if !ok {
+		n = 1
+	}
+	unit, ok := p.keyword(periodUnits...)
+	if !ok {
+		p.pos = start
+		return 0, false
+	}
+	day := 24 * time.Hour
+	lengths := map[string]time.Duration{"year": 365 * day, "month": 30 * day, "week": 7 * day, "day": day, "hour": time.Hour}
+	length := lengths[strings.TrimSuffix(unit, "s")]
+	// about 292 years fit into duration, longer period is left to be reported as unexpected
+	if n > maxPeriodCount || time.Duration(n) > math.MaxInt64/length {
+		p.pos = start
+		return 0, false
+	}
+	return time.Duration(n) * length, true
+}
@@ -0,0 +1,393 @@
+package accounting_bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func newMessage(text, languageCode string) *tgbotapi.Message {
+	return &tgbotapi.Message{Text: text, From: &tgbotapi.User{ID: 1, LanguageCode: languageCode}}
+}
+
+func TestCommandRegistry(t *testing.T) {
+	for _, spec := range commands {
+		for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+			if commandsByName[name] != spec {
+				t.Errorf("%s is not registered", name)
+			}
+			text := spec.Name
+			if spec.Example != "" {
+				if !strings.HasPrefix(spec.Example, spec.Name) {
+					t.Errorf("example of %s is %q", spec.Name, spec.Example)
+				}
+				text = spec.Example
+			}
+			text = name + strings.TrimPrefix(text, spec.Name)
+			cmd, err := ParseCommand(newMessage(text, "en"))
+			if err != nil {
+				t.Errorf("%q: %v", text, err)
+				continue
+			}
+			if cmd == nil {
+				t.Errorf("%q: no command", text)
+			}
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		lang string
+		want Command
+	}{
+		{"/help", "en", &HelpCommand{}},
+		{"/help dump", "en", &HelpCommand{Command: "/dump"}},
+		{"/help /export", "en", &HelpCommand{Command: "/dump"}},
+		{"/start", "en", &StartCommand{}},
+		{"/start@accounting_bot secret", "en", &StartCommand{Code: "secret"}},
+		{"/currency EUR", "en", &CurrencyCommand{Currency: "EUR"}},
+		{"/tz Europe/Moscow", "en", &TimezoneCommand{Timezone: "Europe/Moscow"}},
+		{"/last", "en", &LastCommand{Limit: lastDefaultLimit, Tags: []string{}}},
+		{"/last 20 #food/cafe", "en", &LastCommand{Limit: 20, Tags: []string{"#food/cafe"}}},
+		{"/find coffee #food page 2", "en", &FindCommand{Text: "coffee", Tags: []string{"#food"}, Page: 2}},
+		{"/search next page", "en", &FindCommand{Text: "next page", Tags: []string{}, Page: 1}},
+		{`/find "page" 2`, "en", &FindCommand{Text: "page 2", Tags: []string{}, Page: 1}},
+		{"/find page one", "en", &FindCommand{Text: "page one", Tags: []string{}, Page: 1}},
+		{"/chart bar by week #food", "en", &ChartCommand{Kind: "bar", Group: "week", Tags: []string{"#food"}}},
+		{"/report off", "en", &ReportCommand{}},
+		{"/report weekly", "en", &ReportCommand{Period: "weekly"}},
+		{"/export", "en", &DumpCommand{Format: "csv", Tags: []string{}}},
+		{"/dump Ledger #food", "en", &DumpCommand{Format: "ledger", Tags: []string{"#food"}}},
+		{"/tags", "en", &ListTagsCommand{SearchTags: []string{}}},
+		{"/tag #burger #food/fast", "en", &AddTagCommand{SearchTag: "#burger", Tags: []string{"#food/fast"}}},
+		{"/untag #a #b", "en", &RemoveTagCommand{Tags: []string{"#a", "#b"}}},
+		{"/rename #fod #food", "en", &MergeTagsCommand{Tags: []string{"#fod"}, Into: "#food"}},
+		{"/merge #cafe #bar #food", "en", &MergeTagsCommand{Tags: []string{"#cafe", "#bar"}, Into: "#food"}},
+		{`/rule "star bucks" #coffee`, "en", &AddRuleCommand{Rule: Rule{Pattern: "star bucks", Tags: []string{"#coffee"}}}},
+		{"/rule /star(bucks)?/ #coffee #cafe", "en", &AddRuleCommand{
+			Rule: Rule{Pattern: "star(bucks)?", Regexp: true, Tags: []string{"#coffee", "#cafe"}},
+		}},
+		{"/rule delete 3", "en", &DeleteRuleCommand{ID: "3"}},
+		{"/rule apply 3", "en", &ApplyRuleCommand{ID: "3"}},
+		{"/rules", "en", &ListRulesCommand{}},
+		{"/account add card usd", "en", &AddAccountCommand{Account: Account{Name: "card", Currency: "USD"}}},
+		{"/account add card EUR 1000,50", "ru", &AddAccountCommand{Account: Account{Name: "card", Currency: "EUR"}, Value: 1000.5}},
+		{"/accounts", "en", &ListAccountsCommand{}},
+		{"/transfer 10+5 card cash", "en", &TransferCommand{From: "card", To: "cash", Value: 15}},
+		{"/map", "en", &ListMapAccountsCommand{}},
+		{"/map #food", "en", &MapAccountCommand{Tag: "#food"}},
+		{"/map #food Expenses:Food", "en", &MapAccountCommand{Tag: "#food", Account: "Expenses:Food"}},
+		{"/join", "en", &JoinCommand{}},
+		{"/members", "en", &MembersCommand{}},
+		{"/debts", "en", &DebtsCommand{}},
+		{"/settle @alice 20,5", "ru", &SettleCommand{Name: "alice", Value: 20.5}},
+		{"/admin users", "en", &AdminCommand{Action: "users"}},
+		{"/admin disable 123456", "en", &AdminCommand{Action: "disable", TelegramID: 123456}},
+		{"/admin broadcast new  version", "en", &AdminCommand{Action: "broadcast", Text: "new  version"}},
+		{"/invite", "en", &InviteCommand{MaxUses: 1, TTL: inviteDefaultTTL}},
+		{"/invite 5", "en", &InviteCommand{MaxUses: 5, TTL: inviteDefaultTTL}},
+		{"/invite 2 days", "en", &InviteCommand{MaxUses: 1, TTL: 48 * time.Hour}},
+		{"/invite 5 hours", "en", &InviteCommand{MaxUses: 1, TTL: 5 * time.Hour}},
+		{"/invite 5 1 hour", "en", &InviteCommand{MaxUses: 5, TTL: time.Hour}},
+	}
+	for _, test := range tests {
+		cmd, err := ParseCommand(newMessage(test.text, test.lang))
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd, test.want) {
+			t.Errorf("%q: got %#v, want %#v", test.text, cmd, test.want)
+		}
+	}
+}
+
+func TestParseCommandDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		chat     string
+		isImport bool
+	}{
+		{name: "statement.csv", chat: "private", isImport: true},
+		{name: "photo.jpg", chat: "private", isImport: true},
+		{name: "Statement.CSV", chat: "group", isImport: true},
+		{name: "photo.jpg", chat: "group", isImport: false},
+		{name: "photo.jpg", chat: "supergroup", isImport: false},
+	}
+	for _, test := range tests {
+		msg := newMessage("", "en")
+		msg.Chat = &tgbotapi.Chat{ID: 1, Type: test.chat}
+		msg.Document = &tgbotapi.Document{FileID: "file", FileName: test.name}
+		cmd, err := ParseCommand(msg)
+		if _, ok := cmd.(*ImportCommand); ok != test.isImport {
+			t.Errorf("%s in %s chat: got %#v, %v", test.name, test.chat, cmd, err)
+		}
+	}
+}
+
+func TestParseCommandPeriod(t *testing.T) {
+	cmd, err := ParseCommand(newMessage("/find coffee 2 weeks", "en"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := cmd.(*FindCommand)
+	if find.Text != "coffee" || find.From != getPeriodBeginning(2, "weeks") {
+		t.Errorf("got %#v", find)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		text       string
+		lang       string
+		value      float32
+		comment    string
+		tags       []string
+		account    string
+		split      []string
+		expression string
+	}{
+		{text: "12.5 lunch #food", lang: "en", value: 12.5, comment: "lunch #food", tags: []string{"#food"}},
+		{text: "12,5 lunch", lang: "ru", value: 12.5, comment: "lunch"},
+		{text: "1,200 rent", lang: "en", value: 1200, comment: "rent"},
+		{text: "1,200 rent", lang: "ru", value: 1.2, comment: "rent"},
+		{text: "1,200.50 rent", lang: "ru", value: 1200.5, comment: "rent"},
+		{text: "1 200,50 rent", lang: "ru", value: 1200.5, comment: "rent"},
+		{text: "12 100 coffee", lang: "ru", value: 12100, comment: "coffee"},
+		{text: "12 100 coffee", lang: "en", value: 12, comment: "100 coffee"},
+		{text: "42", lang: "", value: 42},
+		{text: "0.005", lang: "en", value: 0.01},
+		{text: "12.5+3*(4-1)/2 lunch", lang: "en", value: 17, comment: "lunch", expression: "12.5+3*(4-1)/2"},
+		{text: "(10+5)*2 taxi", lang: "en", value: 30, comment: "taxi", expression: "(10+5)*2"},
+		{text: "10/3 pizza", lang: "en", value: 3.33, comment: "pizza", expression: "10/3"},
+		{
+			text:    "25 dinner #food/restaurant #date with @alice and @bob $card",
+			lang:    "en",
+			value:   25,
+			comment: "dinner #food/restaurant #date with @alice and @bob $card",
+			tags:    []string{"#food/restaurant", "#date"},
+			account: "card",
+			split:   []string{"alice", "bob"},
+		},
+		{text: "5 coffee $5 tip", lang: "en", value: 5, comment: "coffee $5 tip"},
+		{text: "5 coffee $2go", lang: "en", value: 5, comment: "coffee $2go", account: "2go"},
+		{text: "5 mail@example.com", lang: "en", value: 5, comment: "mail@example.com"},
+	}
+	for _, test := range tests {
+		cmd, err := ParseCommand(newMessage(test.text, test.lang))
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		entry := cmd.(*EntryCommand)
+		if test.tags == nil {
+			test.tags = []string{}
+		}
+		if entry.Entry.Value != test.value || entry.Entry.Comment != test.comment ||
+			!reflect.DeepEqual(entry.Entry.Tags, test.tags) || entry.Entry.Account != test.account ||
+			!reflect.DeepEqual(entry.Split, test.split) || entry.Entry.Expression != test.expression {
+			t.Errorf("%q: got %+v split %v", test.text, entry.Entry, entry.Split)
+		}
+		if entry.Entry.AuthorID != 1 {
+			t.Errorf("%q: author %d", test.text, entry.Entry.AuthorID)
+		}
+	}
+}
+
+func TestParseEntryTextMention(t *testing.T) {
+	msg := newMessage("30 taxi with Alice", "en")
+	msg.Entities = &[]tgbotapi.MessageEntity{
+		{Type: "bold", Offset: 0, Length: 2},
+		{Type: "text_mention", Offset: 13, Length: 5, User: &tgbotapi.User{ID: 42, FirstName: "Alice"}},
+	}
+	cmd, err := ParseCommand(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := cmd.(*EntryCommand).SplitIDs; !reflect.DeepEqual(ids, []int64{42}) {
+		t.Errorf("got %v", ids)
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		lang string
+		want error
+		// token and position are checked for syntax errors when token is set
+		token    string
+		position int
+	}{
+		{text: "/dumpfoo", want: &UnknownCommandError{}},
+		{text: "/dumpfoo csv", want: &UnknownCommandError{}},
+		{text: "/unknown", want: &UnknownCommandError{}},
+		{text: "hello", want: &UnknownCommandError{}},
+		{text: "/help dumpfoo", want: &UnknownCommandError{}},
+		{text: "/help admin", want: &UnknownCommandError{}},
+		{text: "/start bad-code", want: &InvalidSyntaxError{}, token: "bad-code", position: 7},
+		{text: "/currency", want: &InvalidSyntaxError{}},
+		{text: "/currency XX", want: &InvalidCurrencyError{}},
+		{text: "/tz Mars/Base", want: &InvalidTimezoneError{}},
+		{text: "/last 100", want: &InvalidSyntaxError{}, token: "100", position: 6},
+		{text: "/last 5 food", want: &InvalidSyntaxError{}, token: "food", position: 8},
+		{text: "/find", want: &InvalidSyntaxError{}},
+		{text: "/find coffee page 0", want: &InvalidSyntaxError{}, token: "0", position: 18},
+		{text: "/find coffee page 999999999999", want: &InvalidSyntaxError{}, token: "999999999999", position: 18},
+		{text: "/members 99999 days", want: &InvalidSyntaxError{}, token: "99999", position: 9},
+		{text: "/invite 999999 years", want: &InvalidSyntaxError{}, token: "999999", position: 8},
+		{text: "/invite 5 300 years", want: &InvalidSyntaxError{}, token: "300", position: 10},
+		{text: "/chart by year", want: &InvalidSyntaxError{}, token: "year", position: 10},
+		{text: "/report daily", want: &InvalidSyntaxError{}, token: "daily", position: 8},
+		{text: "/dump csv ledger", want: &InvalidSyntaxError{}, token: "ledger", position: 10},
+		{text: "/tag #a", want: &InvalidSyntaxError{}},
+		{text: "/tag #a b", want: &InvalidSyntaxError{}, token: "b", position: 8},
+		{text: "/rename #a #b #c", want: &InvalidSyntaxError{}},
+		{text: `/rule "starbucks #coffee`, want: &InvalidSyntaxError{}, token: `"starbucks #coffee`, position: 6},
+		{text: "/rule /(/ #a", want: &InvalidSyntaxError{}, token: "/(/", position: 6},
+		{text: "/rule starbucks #coffee", want: &InvalidSyntaxError{}, token: "starbucks", position: 6},
+		{text: `/rule "starbucks"`, want: &InvalidSyntaxError{}},
+		{text: "/rules all", want: &InvalidSyntaxError{}, token: "all", position: 7},
+		{text: "/account add 5 USD", want: &InvalidSyntaxError{}, token: "5", position: 13},
+		{text: "/account add card XYZ1", want: &InvalidCurrencyError{}},
+		{text: "/transfer 0 card cash", want: &InvalidSyntaxError{}, token: "0", position: 10},
+		{text: "/transfer 10 card", want: &InvalidSyntaxError{}},
+		{text: "/map food", want: &InvalidSyntaxError{}, token: "food", position: 5},
+		{text: "/settle alice 20", want: &InvalidSyntaxError{}, token: "alice", position: 8},
+		{text: "/settle @alice 0", want: &InvalidSyntaxError{}, token: "0", position: 15},
+		{text: "/admin enable abc", want: &InvalidSyntaxError{}, token: "abc", position: 14},
+		{text: "/admin broadcast", want: &InvalidSyntaxError{}},
+		{text: "/invite 0", want: &InvalidSyntaxError{}, token: "0", position: 8},
+		{text: "/join now", want: &InvalidSyntaxError{}, token: "now", position: 6},
+		{text: "0 coffee", lang: "en", want: &InvalidSyntaxError{}, token: "0", position: 0},
+		{text: "10/0 pizza", lang: "en", want: &InvalidSyntaxError{}},
+		{text: "(10+5 taxi", lang: "en", want: &InvalidSyntaxError{}},
+		{text: "(10 + 5)*2 taxi", lang: "en", want: &InvalidSyntaxError{}},
+		{text: "2021-03-01 rent", lang: "en", want: &InvalidSyntaxError{}, token: "2021-03-01", position: 0},
+		{text: "1000000000*1000000000 x", lang: "en", want: &InvalidSyntaxError{}},
+		{text: "1,200 rent", want: &InvalidSyntaxError{}, token: "1,200", position: 0},
+		{text: "12 100 coffee", want: &InvalidSyntaxError{}, token: "12 100", position: 0},
+		{text: "1,2,3 x", lang: "en", want: &InvalidSyntaxError{}},
+	}
+	for _, test := range tests {
+		_, err := ParseCommand(newMessage(test.text, test.lang))
+		if reflect.TypeOf(err) != reflect.TypeOf(test.want) {
+			t.Errorf("%q: got %T %v, want %T", test.text, err, err, test.want)
+			continue
+		}
+		syntaxErr, ok := err.(*InvalidSyntaxError)
+		if !ok {
+			continue
+		}
+		if syntaxErr.Expected == "" {
+			t.Errorf("%q: no usage in %v", test.text, err)
+		}
+		if test.token == "" {
+			continue
+		}
+		if syntaxErr.Token != test.token || !syntaxErr.HasPosition || syntaxErr.Position != test.position {
+			t.Errorf("%q: got %q at %d (%v), want %q at %d", test.text, syntaxErr.Token, syntaxErr.Position,
+				syntaxErr.HasPosition, test.token, test.position)
+		}
+	}
+}
+
+func TestDescribeSyntaxError(t *testing.T) {
+	last := commandsByName["/last"]
+	tests := []struct {
+		name string
+		err  InvalidSyntaxError
+		s    string
+		want InvalidSyntaxError
+	}{
+		{
+			name: "command usage",
+			err:  InvalidSyntaxError{},
+			s:    "/last",
+			want: InvalidSyntaxError{Command: "/last", Expected: last.Usage(), Example: last.Example},
+		},
+		{
+			name: "alias keeps its name",
+			err:  InvalidSyntaxError{},
+			s:    "/search",
+			want: InvalidSyntaxError{
+				Command:  "/search",
+				Expected: commandsByName["/find"].Usage(),
+				Example:  commandsByName["/find"].Example,
+			},
+		},
+		{
+			name: "entry usage",
+			err:  InvalidSyntaxError{Token: "1,200"},
+			s:    "1,200 rent",
+			want: InvalidSyntaxError{Token: "1,200", Position: 0, HasPosition: true, Expected: entrySyntax, Example: entryExample},
+		},
+		{
+			name: "position is found",
+			err:  InvalidSyntaxError{Token: "food"},
+			s:    "/last 5 food",
+			want: InvalidSyntaxError{
+				Command: "/last", Token: "food", Position: 8, HasPosition: true,
+				Expected: last.Usage(), Example: last.Example,
+			},
+		},
+		{
+			name: "known position is kept",
+			err:  InvalidSyntaxError{Token: "5", Position: 8, HasPosition: true},
+			s:    "/last 5 5",
+			want: InvalidSyntaxError{
+				Command: "/last", Token: "5", Position: 8, HasPosition: true,
+				Expected: last.Usage(), Example: last.Example,
+			},
+		},
+		{
+			name: "known zero position is kept",
+			err:  InvalidSyntaxError{Token: "x", Position: 0, HasPosition: true},
+			s:    "x 1 x",
+			want: InvalidSyntaxError{Token: "x", Position: 0, HasPosition: true, Expected: entrySyntax, Example: entryExample},
+		},
+		{
+			name: "missing token has no position",
+			err:  InvalidSyntaxError{Token: "zzz"},
+			s:    "/last 5",
+			want: InvalidSyntaxError{Command: "/last", Token: "zzz", Expected: last.Usage(), Example: last.Example},
+		},
+		{
+			name: "expected usage is kept",
+			err:  InvalidSyntaxError{Token: "1,200", Expected: "1200 or 1.2"},
+			s:    "1,200 rent",
+			want: InvalidSyntaxError{Token: "1,200", HasPosition: true, Expected: "1200 or 1.2"},
+		},
+	}
+	for _, test := range tests {
+		err := test.err
+		describeSyntaxError(&err, test.s)
+		if !reflect.DeepEqual(err, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestInvalidSyntaxErrorString(t *testing.T) {
+	tests := []struct {
+		err  InvalidSyntaxError
+		want string
+	}{
+		{InvalidSyntaxError{}, "syntax error"},
+		{InvalidSyntaxError{Token: "x"}, `syntax error near "x"`},
+		{InvalidSyntaxError{Token: "x", HasPosition: true}, `syntax error near "x" at position 1`},
+		{
+			InvalidSyntaxError{Command: "/last", Token: "x", Position: 6, HasPosition: true, Expected: "/last", Example: "/last 5"},
+			"syntax error in /last near \"x\" at position 7\nusage: /last\nexample: /last 5",
+		},
+	}
+	for _, test := range tests {
+		if s := test.err.String(); s != test.want {
+			t.Errorf("got %q, want %q", s, test.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package accounting_bot
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/sirupsen/logrus"
+)
+
+// classes of commands limited separately, heavy commands run expensive queries or render files
+const (
+	RateClassDefault = "default"
+	RateClassHeavy   = "heavy"
+)
+
+// buckets which are full again are dropped from time to time to keep memory bounded
+const rateLimiterCleanupInterval = 10 * time.Minute
+
+// RateLimit is a token bucket: Burst requests can be made at once, then PerMinute requests are allowed,
+// zero PerMinute disables limit
+type RateLimit struct {
+	PerMinute float64
+	Burst     int
+}
+
+func commandClass(cmd Command) string {
+	switch cmd.(type) {
+	case *DumpCommand, *ChartCommand, *FindCommand, *ImportCommand:
+		return RateClassHeavy
+	}
+	return RateClassDefault
+}
+
+type rateBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// limited bucket is already reported, so flood of messages causes single warning
+	limited bool
+}
+
+type rateKey struct {
+	id    int64
+	class string
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	limits    map[string]RateLimit
+	buckets   map[rateKey]*rateBucket
+	cleanedAt time.Time
+}
+
+func newRateLimiter(limits map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limits:    limits,
+		buckets:   make(map[rateKey]*rateBucket),
+		cleanedAt: time.Now(),
+	}
+}
+
+// Allow takes token from bucket of telegram user for class of commands,
+// when request is not allowed returns time to wait and whether it is the first rejected request in a row
+func (l *rateLimiter) Allow(id int64, class string) (bool, time.Duration, bool) {
+	limit, ok := l.limits[class]
+	if !ok || limit.PerMinute <= 0 {
+		return true, 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.cleanedAt) > rateLimiterCleanupInterval {
+		l.cleanup(now)
+	}
+	key := rateKey{id: id, class: class}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateBucket{tokens: math.Max(float64(limit.Burst), 1), updatedAt: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = refill(bucket, limit, now)
+	bucket.updatedAt = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.limited = false
+		return true, 0, false
+	}
+	wait := time.Duration((1 - bucket.tokens) / limit.PerMinute * float64(time.Minute))
+	first := !bucket.limited
+	bucket.limited = true
+	return false, wait, first
+}
+
+// allow checks rate limit of user who sent message, the first rejected request is answered unless it is quiet
+// and logged, the rest are dropped silently
+func (b *Bot) allow(ctx context.Context, chatID int64, from *tgbotapi.User, class string, quiet bool) bool {
+	id := chatID
+	if from != nil {
+		id = int64(from.ID)
+	}
+	ok, wait, first := b.limiter.Allow(id, class)
+	if ok {
+		return true
+	}
+	if first {
+		b.log(ctx).WithFields(logrus.Fields{
+			"user_id": id,
+			"chat_id": chatID,
+			"class":   class,
+		}).Warn("rate limit exceeded")
+		if !quiet {
+			_ = b.handleError(chatID, &RateLimitError{Wait: wait})
+		}
+	}
+	return false
+}
+
+func refill(bucket *rateBucket, limit RateLimit, now time.Time) float64 {
+	tokens := bucket.tokens + now.Sub(bucket.updatedAt).Minutes()*limit.PerMinute
+	return math.Min(tokens, math.Max(float64(limit.Burst), 1))
+}
+
+func (l *rateLimiter) cleanup(now time.Time) {
+	for key, bucket := range l.buckets {
+		limit := l.limits[key.class]
+		if refill(bucket, limit, now) >= math.Max(float64(limit.Burst), 1) {
+			delete(l.buckets, key)
+		}
+	}
+	l.cleanedAt = now
+}
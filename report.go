@@ -0,0 +1,130 @@
+package accounting_bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	reportsCheckInterval = 10 * time.Minute
+	// reports are sent at this hour of user's local time
+	reportHour  = 9
+	reportLimit = 5
+)
+
+// reportPeriod returns the last complete period before now in location of now
+func reportPeriod(kind string, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if kind == "monthly" {
+		to := today.AddDate(0, 0, 1-today.Day())
+		return to.AddDate(0, -1, 0), to
+	}
+	// weeks start on monday
+	to := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	return to.AddDate(0, 0, -7), to
+}
+
+// FormatReport renders summary of period compared to previous one
+func FormatReport(kind string, current, previous *Summary) string {
+	// TODO: i18n
+	b := strings.Builder{}
+	title := "Weekly"
+	if kind == "monthly" {
+		title = "Monthly"
+	}
+	b.WriteString(fmt.Sprintf(
+		"%s report %s — %s\n",
+		title, current.From.Format("2006-01-02"), current.To.AddDate(0, 0, -1).Format("2006-01-02"),
+	))
+	b.WriteString(fmt.Sprintf("Total: %.2f%s in %d entries", current.Total, current.Currency, current.Count))
+	if previous != nil && previous.Total > 0 {
+		b.WriteString(fmt.Sprintf(" (%+.0f%% to previous period)", (current.Total/previous.Total-1)*100))
+	}
+	b.WriteString("\n")
+	if len(current.Tags) > 0 {
+		b.WriteString("\nTop tags:\n")
+		for _, tag := range current.Tags {
+			b.WriteString(fmt.Sprintf("%s %.2f%s\n", tag.Tag, tag.Total, tag.Currency))
+		}
+	}
+	if len(current.Entries) > 0 {
+		b.WriteString("\nBiggest entries:\n")
+		for _, entry := range current.Entries {
+			b.WriteString(fmt.Sprintf(
+				"%s %.2f%s %s\n", entry.CreatedAt.Format("2006-01-02"), entry.Value, entry.Currency, entry.Comment,
+			))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// runReports periodically sends scheduled reports until ctx is cancelled
+func (b *Bot) runReports(ctx context.Context) {
+	ticker := time.NewTicker(reportsCheckInterval)
+	defer ticker.Stop()
+	for {
+		// every check is logged as a separate job
+		ctx := ContextWithLogger(ctx, b.logger.WithField("correlation_id", newCorrelationID()))
+		if err := b.sendReports(ctx); err != nil {
+			b.log(ctx).WithError(err).Error("failed to send reports")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Bot) sendReports(ctx context.Context) error {
+	users, err := b.storage.GetUsersWithReports(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if ctx.Err() != nil {
+			return nil
+		}
+		now := time.Now().In(user.Location())
+		from, to := reportPeriod(user.Features.Report, now)
+		if now.Before(to.Add(reportHour*time.Hour)) || user.Features.ReportSentAt.After(to) {
+			continue
+		}
+		if err := b.sendReport(ctx, user, from, to); err != nil {
+			b.log(ctx).WithError(err).WithField("user", user.ID).Error("failed to send report")
+		}
+	}
+	return nil
+}
+
+func (b *Bot) sendReport(ctx context.Context, user *User, from, to time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	current, err := b.storage.GetSummary(ctx, user, from, to, reportLimit)
+	if err != nil {
+		return err
+	}
+	prevFrom, _ := reportPeriod(user.Features.Report, from)
+	previous, err := b.storage.GetSummary(ctx, user, prevFrom, from, reportLimit)
+	if err != nil {
+		return err
+	}
+	if _, err := b.send(tgbotapi.NewMessage(
+		user.TelegramID, FormatReport(user.Features.Report, current, previous),
+	)); err != nil {
+		if !isForbiddenError(err) {
+			return err
+		}
+		// user blocked bot, reports are disabled instead of being retried forever
+		b.log(ctx).WithField("user", user.ID).Info("reports disabled, user blocked bot")
+		user.Features.Report = ""
+	}
+
+	user.Features.ReportSentAt = time.Now()
+	return b.storage.SaveReport(ctx, user)
+}
@@ -6,12 +6,78 @@ import (
 )
 
 type Repository interface {
+	// Ping checks connection to storage
+	Ping(ctx context.Context) error
+	// SaveUser creates or updates user by telegram id including version of bot user has seen changes of
 	SaveUser(ctx context.Context, user *User) (*User, error)
 	GetUserByTelegramID(ctx context.Context, id int64) (*User, error)
+	// GetUsersWithReports returns enabled users subscribed to scheduled reports
+	GetUsersWithReports(ctx context.Context) ([]*User, error)
+	// SaveReport saves only report settings of user, so settings changed meanwhile are not overwritten
+	SaveReport(ctx context.Context, user *User) error
+	// ListUsers returns users with number of their entries, most recently active first
+	ListUsers(ctx context.Context) ([]*UserSummary, error)
+	// ListEnabledUserIDs returns telegram ids of enabled users
+	ListEnabledUserIDs(ctx context.Context) ([]int64, error)
+	// SetUserEnabled enables or disables user and reports if there is such one
+	SetUserEnabled(ctx context.Context, telegramID int64, enabled bool) (bool, error)
+	SaveInvite(ctx context.Context, invite *Invite) (*Invite, error)
+	// CreateUser creates user with optional first member of shared ledger and uses invite code once unless it is empty,
+	// nothing is saved if invite is expired or used up
+	CreateUser(ctx context.Context, user *User, member *Member, invite string) (*User, error)
+	// GetStats returns number of users and entries, active users are ones with entries changed since time
+	GetStats(ctx context.Context, activeSince time.Time) (*Stats, error)
+	SaveMember(ctx context.Context, user *User, member *Member) (*Member, error)
+	// GetMember returns member of shared ledger or nil if there is no such one
+	GetMember(ctx context.Context, user *User, telegramID int64) (*Member, error)
+	ListMembers(ctx context.Context, user *User) ([]*Member, error)
+	// SaveEntry creates entry or updates entry of the same message, edits of deleted entry are refused
+	// with EntryNotFoundError, tags added to entry by buttons are kept
 	SaveEntry(ctx context.Context, user *User, command *Entry) (*Entry, error)
+	// ImportEntries saves entries skipping already existing ones and returns number of saved entries
+	ImportEntries(ctx context.Context, user *User, entries []*Entry) (int, error)
+	GetEntry(ctx context.Context, user *User, id string) (*Entry, error)
+	UpdateEntry(ctx context.Context, user *User, entry *Entry) (*Entry, error)
+	// DeleteEntry marks entry as deleted and cancels its split
+	DeleteEntry(ctx context.Context, user *User, id string) error
+	// SaveSplit replaces debts of entry, value of entry is shared equally between creditor and debtors
+	SaveSplit(ctx context.Context, user *User, entry *Entry, creditor int64, debtors []int64) error
+	// SaveSettlement records payment from one member to another
+	SaveSettlement(ctx context.Context, user *User, from, to int64, value float32, currency string) error
+	GetBalances(ctx context.Context, user *User) ([]*Balance, error)
+	// SaveAccount creates account, AccountExistsError is returned if user already has account with such name
+	SaveAccount(ctx context.Context, user *User, account *Account) (*Account, error)
+	GetAccount(ctx context.Context, user *User, name string) (*Account, error)
+	// ListAccounts returns accounts with balances
+	ListAccounts(ctx context.Context, user *User) ([]*Account, error)
+	// SaveTransfer moves money between accounts, money comes from outside when from is nil
+	SaveTransfer(ctx context.Context, user *User, from, to *Account, value float32) error
 	SaveReplyID(ctx context.Context, user *User, message, reply int64) error
 	GetAllEntries(ctx context.Context, user *User, from time.Time, tags []string) ([]*Entry, error)
+	// ListEntries returns page of entries from most recent ones and total number of them
+	ListEntries(ctx context.Context, user *User, tags []string, offset, limit int) ([]*Entry, int, error)
+	// FindEntries searches entries by comment and returns requested page of results and total number of them
+	FindEntries(
+		ctx context.Context, user *User, text string, from time.Time, tags []string, offset, limit int,
+	) ([]*Entry, int, error)
+	// SumByTags returns spendings by top level of the first tag of entries, so every entry is counted once,
+	// entries without tags are summed under empty tag
+	SumByTags(ctx context.Context, user *User, from time.Time, tags []string) ([]*TagSummary, error)
+	// SumByPeriods returns spendings grouped by day, week or month in timezone of user, periods without spendings
+	// are omitted
+	SumByPeriods(ctx context.Context, user *User, from time.Time, tags []string, period string) ([]*PeriodSummary, error)
+	SumByMembers(ctx context.Context, user *User, from time.Time) ([]*MemberSummary, error)
+	// GetSummary returns spendings in user's currency with top tags and the biggest entries
+	GetSummary(ctx context.Context, user *User, from, to time.Time, limit int) (*Summary, error)
 	AddTag(ctx context.Context, user *User, search string, tags []string) error
 	RemoveTag(ctx context.Context, user *User, tags []string) error
-	ListTag(ctx context.Context, user *User, search []string) ([]string, error)
+	MergeTags(ctx context.Context, user *User, tags []string, into string) error
+	ListTag(ctx context.Context, user *User, search []string) ([]*TagSummary, error)
+	// FrequentTags returns most used tags of user
+	FrequentTags(ctx context.Context, user *User, limit int) ([]string, error)
+	SaveRule(ctx context.Context, user *User, rule *Rule) (*Rule, error)
+	ListRules(ctx context.Context, user *User) ([]*Rule, error)
+	DeleteRule(ctx context.Context, user *User, id string) error
+	// ApplyRule adds rule tags to existing entries and returns number of updated entries
+	ApplyRule(ctx context.Context, user *User, id string) (int64, error)
 }
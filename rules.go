@@ -0,0 +1,62 @@
+package accounting_bot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Compile prepares regular expression of rule, it should be called once after rule is loaded
+func (r *Rule) Compile() error {
+	if !r.Regexp {
+		return nil
+	}
+	re, err := regexp.Compile("(?i)" + r.Pattern)
+	if err != nil {
+		return err
+	}
+	r.re = re
+	return nil
+}
+
+// Match checks if comment contains rule keyword or matches rule regular expression, case insensitive
+func (r *Rule) Match(comment string) bool {
+	if r.Regexp {
+		if r.re == nil && r.Compile() != nil {
+			return false
+		}
+		return r.re.MatchString(comment)
+	}
+	return strings.Contains(strings.ToLower(comment), strings.ToLower(r.Pattern))
+}
+
+func (r *Rule) String() string {
+	if r.Regexp {
+		return fmt.Sprintf("/%s/ %s", r.Pattern, strings.Join(r.Tags, " "))
+	}
+	return fmt.Sprintf(`"%s" %s`, r.Pattern, strings.Join(r.Tags, " "))
+}
+
+// ApplyRules returns tags extended with tags of all rules matching comment
+func ApplyRules(rules []*Rule, comment string, tags []string) []string {
+	result := tags[:len(tags):len(tags)]
+	for _, rule := range rules {
+		if !rule.Match(comment) {
+			continue
+		}
+		for _, tag := range rule.Tags {
+			if !containsString(result, tag) {
+				result = append(result, tag)
+			}
+		}
+	}
+	return result
+}
+
+func FormatRules(rules []*Rule) string {
+	b := strings.Builder{}
+	for _, rule := range rules {
+		b.WriteString(fmt.Sprintf("%s. %s\n", rule.ID, rule.String()))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
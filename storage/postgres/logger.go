@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"context"
+
+	bot "github.com/borodyadka/accounting-bot"
+	"github.com/jackc/pgx/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// queryLogger writes pgx logs with fields of update which context is passed to repository
+type queryLogger struct {
+	logger *logrus.Logger
+}
+
+func (l *queryLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	fields := make(logrus.Fields, len(data))
+	for key, value := range data {
+		// query arguments contain user data like comments of entries
+		if key == "args" {
+			continue
+		}
+		fields[key] = value
+	}
+	// fields of update are written by storage logger, so its namespace and level are kept
+	entry := l.logger.WithFields(bot.LoggerFromContext(ctx, l.logger).Data).WithFields(fields)
+	// pgx logs every query at info level, it is too verbose for info level of bot
+	switch level {
+	case pgx.LogLevelTrace, pgx.LogLevelDebug, pgx.LogLevelInfo:
+		entry.Debug(msg)
+	case pgx.LogLevelWarn:
+		entry.Warn(msg)
+	default:
+		entry.Error(msg)
+	}
+}
@@ -4,20 +4,32 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	bot "github.com/borodyadka/accounting-bot"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 )
 
 const limit = 100_000
 
+// existing entries are tagged by rule in chunks, so history of user is neither locked nor loaded at once
+const applyRuleChunk = 500
+
 type Repository struct {
 	pg *pgxpool.Pool
 }
 
+func (s *Repository) Ping(ctx context.Context) error {
+	_, err := s.pg.Exec(ctx, `SELECT 1`)
+	return err
+}
+
 func (s *Repository) SaveUser(ctx context.Context, user *bot.User) (*bot.User, error) {
 	var id string
 	err := s.pg.QueryRow(
@@ -26,7 +38,7 @@ func (s *Repository) SaveUser(ctx context.Context, user *bot.User) (*bot.User, e
 		VALUES ($1, $2, $3, $4, $5)
 		ON CONFLICT ("telegram_id") DO UPDATE SET "bot_version" = $2, "enabled" = $3, "currency" = $4, "features" = $5
 		RETURNING "id"::TEXT`,
-		user.TelegramID, bot.VERSION, user.Enabled, user.Currency, user.Features,
+		user.TelegramID, user.BotVersion, user.Enabled, user.Currency, user.Features,
 	).Scan(&id)
 	if err != nil {
 		return nil, err
@@ -34,7 +46,7 @@ func (s *Repository) SaveUser(ctx context.Context, user *bot.User) (*bot.User, e
 	return &bot.User{
 		ID:         id,
 		TelegramID: user.TelegramID,
-		BotVersion: bot.VERSION,
+		BotVersion: user.BotVersion,
 		Enabled:    user.Enabled,
 		Currency:   user.Currency,
 		Features:   user.Features,
@@ -59,32 +71,593 @@ func (s *Repository) GetUserByTelegramID(ctx context.Context, id int64) (*bot.Us
 	return user, nil
 }
 
+func (s *Repository) GetUsersWithReports(ctx context.Context) ([]*bot.User, error) {
+	rows, err := s.pg.Query(
+		ctx,
+		`SELECT "id"::TEXT, "telegram_id", "bot_version", "enabled", "currency", "features"
+		FROM "users"
+		WHERE "enabled" AND COALESCE("features"->>'report', '') <> ''`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]*bot.User, 0, 32)
+	for rows.Next() {
+		user := new(bot.User)
+		if err := rows.Scan(
+			&user.ID, &user.TelegramID, &user.BotVersion, &user.Enabled, &user.Currency, &user.Features,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *Repository) ListEnabledUserIDs(ctx context.Context) ([]int64, error) {
+	rows, err := s.pg.Query(ctx, `SELECT "telegram_id" FROM "users" WHERE "enabled" ORDER BY "telegram_id"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0, 128)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *Repository) SaveReport(ctx context.Context, user *bot.User) error {
+	_, err := s.pg.Exec(
+		ctx,
+		`UPDATE "users" SET "features" = jsonb_set(
+			jsonb_set("features", '{report}', to_jsonb($2::TEXT)), '{report_sent_at}', to_jsonb($3::TIMESTAMPTZ)
+		)
+		WHERE "id" = $1`,
+		user.ID, user.Features.Report, user.Features.ReportSentAt,
+	)
+	return err
+}
+
+func (s *Repository) ListUsers(ctx context.Context) ([]*bot.UserSummary, error) {
+	rows, err := s.pg.Query(
+		ctx,
+		`SELECT "u"."id"::TEXT, "u"."telegram_id", "u"."bot_version", "u"."enabled", "u"."currency", "u"."features",
+			COUNT("e"."id"), COALESCE(MAX("e"."updated_at"), "u"."created_at") AS "last_entry_at"
+		FROM "users" AS "u"
+		LEFT JOIN "entries" AS "e" ON "e"."user_id" = "u"."id" AND "e"."deleted_at" IS NULL
+		GROUP BY "u"."id"
+		ORDER BY "last_entry_at" DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]*bot.UserSummary, 0, 32)
+	for rows.Next() {
+		item := new(bot.UserSummary)
+		user := &item.User
+		if err := rows.Scan(
+			&user.ID, &user.TelegramID, &user.BotVersion, &user.Enabled, &user.Currency, &user.Features,
+			&item.Entries, &item.LastEntryAt,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, item)
+	}
+	return users, rows.Err()
+}
+
+func (s *Repository) SetUserEnabled(ctx context.Context, telegramID int64, enabled bool) (bool, error) {
+	tag, err := s.pg.Exec(ctx, `UPDATE "users" SET "enabled" = $2 WHERE "telegram_id" = $1`, telegramID, enabled)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *Repository) GetStats(ctx context.Context, activeSince time.Time) (*bot.Stats, error) {
+	stats := new(bot.Stats)
+	err := s.pg.QueryRow(
+		ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM "users"),
+			(SELECT COUNT(*) FROM "users" WHERE "enabled"),
+			(SELECT COUNT(DISTINCT "user_id") FROM "entries" WHERE "updated_at" >= $1),
+			(SELECT COUNT(*) FROM "entries" WHERE "deleted_at" IS NULL)`,
+		activeSince,
+	).Scan(&stats.Users, &stats.EnabledUsers, &stats.ActiveUsers, &stats.Entries)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (s *Repository) SaveInvite(ctx context.Context, invite *bot.Invite) (*bot.Invite, error) {
+	result := &bot.Invite{
+		Code:      invite.Code,
+		CreatedBy: invite.CreatedBy,
+		ExpiresAt: invite.ExpiresAt,
+		MaxUses:   invite.MaxUses,
+	}
+	err := s.pg.QueryRow(
+		ctx,
+		`INSERT INTO "invites" ("created_by", "code", "expires_at", "max_uses")
+		VALUES ($1, $2, $3, $4)
+		RETURNING "id"::TEXT`,
+		invite.CreatedBy, invite.Code, invite.ExpiresAt, invite.MaxUses,
+	).Scan(&result.ID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Repository) CreateUser(
+	ctx context.Context, user *bot.User, member *bot.Member, invite string,
+) (*bot.User, error) {
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if invite != "" {
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE "invites" SET "uses" = "uses" + 1
+			WHERE "code" = $1 AND "expires_at" > NOW() AND "uses" < "max_uses"`,
+			invite,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, &bot.InvalidAuthCodeError{}
+		}
+	}
+	result := &bot.User{
+		TelegramID: user.TelegramID,
+		BotVersion: user.BotVersion,
+		Enabled:    user.Enabled,
+		Currency:   user.Currency,
+		Features:   user.Features,
+	}
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO "users" ("telegram_id", "bot_version", "enabled", "currency", "features")
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING "id"::TEXT`,
+		user.TelegramID, user.BotVersion, user.Enabled, user.Currency, user.Features,
+	).Scan(&result.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member != nil {
+		if _, err := tx.Exec(
+			ctx,
+			`INSERT INTO "members" ("user_id", "telegram_id", "name") VALUES ($1, $2, $3)`,
+			result.ID, member.TelegramID, member.Name,
+		); err != nil {
+			return nil, err
+		}
+	}
+	return result, tx.Commit(ctx)
+}
+
+func (s *Repository) SaveMember(ctx context.Context, user *bot.User, member *bot.Member) (*bot.Member, error) {
+	result := &bot.Member{TelegramID: member.TelegramID, Name: member.Name}
+	err := s.pg.QueryRow(
+		ctx,
+		`INSERT INTO "members" ("user_id", "telegram_id", "name")
+		VALUES ($1, $2, $3)
+		ON CONFLICT ("user_id", "telegram_id") DO UPDATE SET "name" = $3
+		RETURNING "id"::TEXT`,
+		user.ID, member.TelegramID, member.Name,
+	).Scan(&result.ID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Repository) GetMember(ctx context.Context, user *bot.User, telegramID int64) (*bot.Member, error) {
+	member := new(bot.Member)
+	err := s.pg.QueryRow(
+		ctx,
+		`SELECT "id"::TEXT, "telegram_id", "name" FROM "members" WHERE "user_id" = $1 AND "telegram_id" = $2`,
+		user.ID, telegramID,
+	).Scan(&member.ID, &member.TelegramID, &member.Name)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *Repository) ListMembers(ctx context.Context, user *bot.User) ([]*bot.Member, error) {
+	rows, err := s.pg.Query(
+		ctx,
+		`SELECT "id"::TEXT, "telegram_id", "name" FROM "members" WHERE "user_id" = $1 ORDER BY "id" ASC`,
+		user.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := make([]*bot.Member, 0, 8)
+	for rows.Next() {
+		member := new(bot.Member)
+		if err := rows.Scan(&member.ID, &member.TelegramID, &member.Name); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
 func (s *Repository) SaveEntry(ctx context.Context, user *bot.User, entry *bot.Entry) (*bot.Entry, error) {
 	result := &bot.Entry{
-		CreatedAt: entry.CreatedAt,
-		Comment:   entry.Comment,
-		Tags:      entry.Tags[:],
-		Currency:  entry.Currency,
-		Value:     entry.Value,
-		MessageID: entry.MessageID,
-		ReplyID:   entry.ReplyID,
+		CreatedAt:  entry.CreatedAt,
+		Comment:    entry.Comment,
+		Tags:       entry.Tags[:],
+		Currency:   entry.Currency,
+		Value:      entry.Value,
+		Expression: entry.Expression,
+		MessageID:  entry.MessageID,
+		ReplyID:    entry.ReplyID,
+		AuthorID:   entry.AuthorID,
+		AccountID:  entry.AccountID,
+		Account:    entry.Account,
+	}
+	// entries of account are in account currency
+	currency := user.Currency
+	if entry.Currency != "" {
+		currency = entry.Currency
 	}
 	err := s.pg.QueryRow(
 		ctx,
 		`INSERT INTO "entries"
-			("created_at", "user_id", "message_id", "reply_id", "currency", "value", "comment", "tags")
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			("created_at", "user_id", "message_id", "reply_id", "currency", "value", "comment", "tags", "author_id",
+			"account_id", "expression")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9::BIGINT, 0), NULLIF($10, '')::BIGINT, NULLIF($11, ''))
 		ON CONFLICT ("user_id", "message_id") DO UPDATE
-			SET "value" = $6, "comment" = $7, "tags" = $8
+			SET "value" = $6, "account_id" = NULLIF($10, '')::BIGINT, "comment" = $7,
+				"tags" = $8 || ARRAY(SELECT UNNEST("entries"."extra_tags") EXCEPT SELECT UNNEST($8::VARCHAR[])),
+				"expression" = NULLIF($11, ''),
+				"currency" = CASE WHEN $10 <> '' THEN $5 ELSE "entries"."currency" END
+			WHERE "entries"."deleted_at" IS NULL
+		RETURNING "id"::TEXT, "created_at", COALESCE("reply_id", 0), "currency", "tags"`,
+		entry.CreatedAt, user.ID, entry.MessageID, entry.ReplyID, currency, entry.Value, entry.Comment, entry.Tags,
+		entry.AuthorID, entry.AccountID, entry.Expression,
+	).Scan(&result.ID, &result.CreatedAt, &result.ReplyID, &result.Currency, &result.Tags)
+	if err != nil {
+		// edits of deleted entry are not saved
+		if err == pgx.ErrNoRows {
+			return nil, &bot.EntryNotFoundError{}
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Repository) ImportEntries(ctx context.Context, user *bot.User, entries []*bot.Entry) (int, error) {
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// entries are copied into temporary table at once and then inserted skipping duplicates
+	if _, err := tx.Exec(
+		ctx,
+		`CREATE TEMPORARY TABLE "import_entries" (
+			"created_at"  TIMESTAMP WITH TIME ZONE NOT NULL,
+			"currency"    CHAR(3)                  NOT NULL,
+			"value"       DECIMAL(10, 2)           NOT NULL,
+			"comment"     VARCHAR(250)             NOT NULL,
+			"tags"        VARCHAR(128)[]           NOT NULL,
+			"external_id" VARCHAR(255)
+		) ON COMMIT DROP`,
+	); err != nil {
+		return 0, err
+	}
+	rows := make([][]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		var externalID interface{}
+		if entry.ExternalID != "" {
+			externalID = entry.ExternalID
+		}
+		rows = append(rows, []interface{}{
+			entry.CreatedAt, entry.Currency, entry.Value, entry.Comment, entry.Tags, externalID,
+		})
+	}
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"import_entries"},
+		[]string{"created_at", "currency", "value", "comment", "tags", "external_id"},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		return 0, err
+	}
+
+	// entries of the same bank transaction id or the same time, value and comment are considered duplicates,
+	// time is compared up to seconds because dumps do not contain fractions of second
+	tag, err := tx.Exec(
+		ctx,
+		`INSERT INTO "entries" ("created_at", "user_id", "currency", "value", "comment", "tags", "external_id")
+		SELECT DISTINCT ON ("i"."external_id", date_trunc('second', "i"."created_at"), "i"."value", "i"."comment")
+			"i"."created_at", $1::BIGINT, "i"."currency", "i"."value", "i"."comment", "i"."tags", "i"."external_id"
+		FROM "import_entries" AS "i"
+		WHERE NOT EXISTS (
+			SELECT 1 FROM "entries" AS "e"
+			WHERE "e"."user_id" = $1 AND CASE WHEN "i"."external_id" IS NOT NULL
+				THEN "e"."external_id" = "i"."external_id"
+				ELSE date_trunc('second', "e"."created_at") = date_trunc('second', "i"."created_at")
+					AND "e"."value" = "i"."value" AND "e"."comment" = "i"."comment"
+			END
+		)
+		ON CONFLICT DO NOTHING`,
+		user.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *Repository) GetEntry(ctx context.Context, user *bot.User, id string) (*bot.Entry, error) {
+	entry := &bot.Entry{}
+	err := s.pg.QueryRow(
+		ctx,
+		`SELECT "id"::TEXT, "created_at", COALESCE("message_id", 0), COALESCE("reply_id", 0), "currency", "value", "comment", "tags"
+		FROM "entries" WHERE "id" = $1 AND "user_id" = $2 AND "deleted_at" IS NULL`,
+		id, user.ID,
+	).Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.MessageID,
+		&entry.ReplyID,
+		&entry.Currency,
+		&entry.Value,
+		&entry.Comment,
+		&entry.Tags,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, &bot.EntryNotFoundError{}
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *Repository) UpdateEntry(ctx context.Context, user *bot.User, entry *bot.Entry) (*bot.Entry, error) {
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// tags which are not in message are remembered, so they are kept when message is edited
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE "entries"
+		SET "created_at" = $3, "currency" = $4, "value" = $5, "comment" = $6, "tags" = $7, "updated_at" = NOW(),
+			"extra_tags" = "extra_tags" || ARRAY(SELECT UNNEST($7::VARCHAR[]) EXCEPT SELECT UNNEST("tags"))
+		WHERE "id" = $1 AND "user_id" = $2 AND "deleted_at" IS NULL`,
+		entry.ID, user.ID, entry.CreatedAt, entry.Currency, entry.Value, entry.Comment, entry.Tags,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, &bot.EntryNotFoundError{}
+	}
+	// shares of split are in currency of entry
+	if _, err := tx.Exec(
+		ctx, `UPDATE "debts" SET "currency" = $2 WHERE "entry_id" = $1`, entry.ID, entry.Currency,
+	); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	result := *entry
+	return &result, nil
+}
+
+func (s *Repository) DeleteEntry(ctx context.Context, user *bot.User, id string) error {
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// entry is kept, so later edits of its message do not create it again
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE "entries" SET "deleted_at" = NOW() WHERE "id" = $1 AND "user_id" = $2 AND "deleted_at" IS NULL`,
+		id, user.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return &bot.EntryNotFoundError{}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM "debts" WHERE "entry_id" = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Repository) SaveSplit(
+	ctx context.Context, user *bot.User, entry *bot.Entry, creditor int64, debtors []int64,
+) error {
+	tx, err := s.pg.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM "debts" WHERE "entry_id" = $1`, entry.ID); err != nil {
+		return err
+	}
+	participants := make([]int64, 0, len(debtors))
+	for _, debtor := range debtors {
+		if debtor == creditor {
+			continue
+		}
+		participants = append(participants, debtor)
+	}
+	if len(participants) > 0 {
+		// creditor pays own share and takes remainder of division
+		share := math.Floor(float64(entry.Value)*100/float64(len(participants)+1)) / 100
+		for _, debtor := range participants {
+			if _, err := tx.Exec(
+				ctx,
+				`INSERT INTO "debts" ("user_id", "entry_id", "debtor_id", "creditor_id", "currency", "value")
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				user.ID, entry.ID, debtor, creditor, entry.Currency, share,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Repository) SaveSettlement(
+	ctx context.Context, user *bot.User, from, to int64, value float32, currency string,
+) error {
+	// payment is stored as debt of receiver to payer, so it compensates existing debts
+	_, err := s.pg.Exec(
+		ctx,
+		`INSERT INTO "debts" ("user_id", "debtor_id", "creditor_id", "currency", "value")
+		VALUES ($1, $2, $3, $4, $5)`,
+		user.ID, to, from, currency, value,
+	)
+	return err
+}
+
+func (s *Repository) GetBalances(ctx context.Context, user *bot.User) ([]*bot.Balance, error) {
+	rows, err := s.pg.Query(
+		ctx,
+		`SELECT "b"."telegram_id", COALESCE("m"."name", ''), "b"."currency", SUM("b"."value")
+		FROM (
+			SELECT "creditor_id" AS "telegram_id", "currency", "value" FROM "debts" WHERE "user_id" = $1
+			UNION ALL
+			SELECT "debtor_id" AS "telegram_id", "currency", -"value" FROM "debts" WHERE "user_id" = $1
+		) AS "b"
+		LEFT JOIN "members" AS "m" ON "m"."user_id" = $1 AND "m"."telegram_id" = "b"."telegram_id"
+		GROUP BY "b"."telegram_id", "m"."name", "b"."currency"
+		HAVING SUM("b"."value") <> 0`,
+		user.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	balances := make([]*bot.Balance, 0, 8)
+	for rows.Next() {
+		balance := new(bot.Balance)
+		if err := rows.Scan(&balance.TelegramID, &balance.Name, &balance.Currency, &balance.Value); err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+	return balances, rows.Err()
+}
+
+func (s *Repository) SaveAccount(ctx context.Context, user *bot.User, account *bot.Account) (*bot.Account, error) {
+	result := &bot.Account{Name: account.Name, Currency: account.Currency}
+	err := s.pg.QueryRow(
+		ctx,
+		`INSERT INTO "accounts" ("user_id", "name", "currency")
+		VALUES ($1, $2, $3)
+		ON CONFLICT ("user_id", "name") DO NOTHING
 		RETURNING "id"::TEXT`,
-		entry.CreatedAt, user.ID, entry.MessageID, entry.ReplyID, user.Currency, entry.Value, entry.Comment, entry.Tags,
+		user.ID, account.Name, account.Currency,
 	).Scan(&result.ID)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, &bot.AccountExistsError{Name: account.Name}
+		}
 		return nil, err
 	}
 	return result, nil
 }
 
+func (s *Repository) GetAccount(ctx context.Context, user *bot.User, name string) (*bot.Account, error) {
+	account := new(bot.Account)
+	err := s.pg.QueryRow(
+		ctx,
+		`SELECT "id"::TEXT, "name", "currency" FROM "accounts" WHERE "user_id" = $1 AND "name" = $2`,
+		user.ID, name,
+	).Scan(&account.ID, &account.Name, &account.Currency)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, &bot.AccountNotFoundError{Name: name}
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *Repository) ListAccounts(ctx context.Context, user *bot.User) ([]*bot.Account, error) {
+	rows, err := s.pg.Query(
+		ctx,
+		`SELECT "a"."id"::TEXT, "a"."name", "a"."currency",
+			COALESCE((SELECT SUM("t"."value") FROM "transfers" AS "t" WHERE "t"."to_account_id" = "a"."id"), 0)
+			- COALESCE((SELECT SUM("t"."value") FROM "transfers" AS "t" WHERE "t"."from_account_id" = "a"."id"), 0)
+			- COALESCE((
+				SELECT SUM("e"."value") FROM "entries" AS "e" WHERE "e"."account_id" = "a"."id" AND "e"."deleted_at" IS NULL
+			), 0)
+		FROM "accounts" AS "a"
+		WHERE "a"."user_id" = $1
+		ORDER BY "a"."name" ASC`,
+		user.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	accounts := make([]*bot.Account, 0, 8)
+	for rows.Next() {
+		account := new(bot.Account)
+		if err := rows.Scan(&account.ID, &account.Name, &account.Currency, &account.Balance); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (s *Repository) SaveTransfer(ctx context.Context, user *bot.User, from, to *bot.Account, value float32) error {
+	var fromID *string
+	if from != nil {
+		fromID = &from.ID
+	}
+	_, err := s.pg.Exec(
+		ctx,
+		`INSERT INTO "transfers" ("user_id", "from_account_id", "to_account_id", "value")
+		VALUES ($1, $2, $3, $4)`,
+		user.ID, fromID, to.ID, value,
+	)
+	return err
+}
+
 func (s *Repository) SaveReplyID(ctx context.Context, user *bot.User, message, reply int64) error {
 	_, err := s.pg.Exec(
 		ctx,
@@ -98,22 +671,27 @@ func (s *Repository) GetAllEntries(
 	ctx context.Context, user *bot.User, from time.Time, tags []string,
 ) ([]*bot.Entry, error) {
 	start := from
-	cond := []string{`"user_id" = $1`, "created_at > $2"}
+	cond := []string{`"user_id" = $1`, `"deleted_at" IS NULL`, "created_at > $2"}
+	tagsCond, tagsArgs := tagsCondition(tags, 2)
 	if len(tags) > 0 {
-		cond = append(cond, "tags @> $3")
+		cond = append(cond, tagsCond)
 	}
 
 	result := make([]*bot.Entry, 0, limit)
 	for {
-		args := []interface{}{user.ID, start}
-		if len(tags) > 0 {
-			args = append(args, tags)
-		}
+		args := append([]interface{}{user.ID, start}, tagsArgs...)
 
 		rows, err := s.pg.Query(
 			ctx,
 			fmt.Sprintf(
-				`SELECT "id"::TEXT, "created_at", "message_id", "reply_id", "currency", "value", "comment", "tags"
+				`SELECT "id"::TEXT, "created_at", COALESCE("message_id", 0), COALESCE("reply_id", 0), "currency", "value", "comment", "tags",
+					COALESCE("author_id", 0),
+					COALESCE((
+						SELECT "m"."name" FROM "members" AS "m"
+						WHERE "m"."user_id" = "entries"."user_id" AND "m"."telegram_id" = "entries"."author_id"
+					), ''),
+					COALESCE("account_id"::TEXT, ''),
+					COALESCE((SELECT "a"."name" FROM "accounts" AS "a" WHERE "a"."id" = "entries"."account_id"), '')
 				FROM "entries" WHERE %s ORDER BY "created_at" ASC LIMIT %d`,
 				strings.Join(cond, " AND "),
 				limit,
@@ -137,6 +715,10 @@ func (s *Repository) GetAllEntries(
 				&entry.Value,
 				&entry.Comment,
 				&entry.Tags,
+				&entry.AuthorID,
+				&entry.Author,
+				&entry.AccountID,
+				&entry.Account,
 			); err != nil {
 				rows.Close()
 				return nil, err
@@ -154,6 +736,213 @@ func (s *Repository) GetAllEntries(
 	return result, nil
 }
 
+func (s *Repository) ListEntries(
+	ctx context.Context, user *bot.User, tags []string, offset, limit int,
+) ([]*bot.Entry, int, error) {
+	cond := []string{`"user_id" = $1`, `"deleted_at" IS NULL`}
+	tagsCond, tagsArgs := tagsCondition(tags, 1)
+	if len(tags) > 0 {
+		cond = append(cond, tagsCond)
+	}
+
+	return s.entriesPage(ctx, strings.Join(cond, " AND "), append([]interface{}{user.ID}, tagsArgs...), offset, limit)
+}
+
+func (s *Repository) FindEntries(
+	ctx context.Context, user *bot.User, text string, from time.Time, tags []string, offset, limit int,
+) ([]*bot.Entry, int, error) {
+	cond := []string{
+		`"user_id" = $1`,
+		`"deleted_at" IS NULL`,
+		`"created_at" > $2`,
+		`to_tsvector('simple', "comment") @@ plainto_tsquery('simple', $3)`,
+	}
+	tagsCond, tagsArgs := tagsCondition(tags, 3)
+	if len(tags) > 0 {
+		cond = append(cond, tagsCond)
+	}
+
+	return s.entriesPage(
+		ctx, strings.Join(cond, " AND "), append([]interface{}{user.ID, from, text}, tagsArgs...), offset, limit,
+	)
+}
+
+func (s *Repository) SumByTags(
+	ctx context.Context, user *bot.User, from time.Time, tags []string,
+) ([]*bot.TagSummary, error) {
+	cond := []string{`"user_id" = $1`, `"deleted_at" IS NULL`, `"created_at" > $2`}
+	tagsCond, tagsArgs := tagsCondition(tags, 2)
+	if len(tags) > 0 {
+		cond = append(cond, tagsCond)
+	}
+
+	// entry is counted once by its first tag, so sums of tags add up to total
+	rows, err := s.pg.Query(
+		ctx,
+		fmt.Sprintf(
+			`SELECT COALESCE(split_part("tags"[1], '/', 1), '') AS "tag", "currency", COUNT(*), SUM("value")
+			FROM "entries"
+			WHERE %s
+			GROUP BY "tag", "currency"
+			ORDER BY SUM("value") DESC, "tag" ASC`,
+			strings.Join(cond, " AND "),
+		),
+		append([]interface{}{user.ID, from}, tagsArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]*bot.TagSummary, 0, 32)
+	for rows.Next() {
+		tag := &bot.TagSummary{}
+		if err := rows.Scan(&tag.Tag, &tag.Currency, &tag.Count, &tag.Total); err != nil {
+			return nil, err
+		}
+		result = append(result, tag)
+	}
+	return result, rows.Err()
+}
+
+func (s *Repository) SumByPeriods(
+	ctx context.Context, user *bot.User, from time.Time, tags []string, period string,
+) ([]*bot.PeriodSummary, error) {
+	cond := []string{`"user_id" = $1`, `"deleted_at" IS NULL`, `"created_at" > $2`}
+	tagsCond, tagsArgs := tagsCondition(tags, 4)
+	if len(tags) > 0 {
+		cond = append(cond, tagsCond)
+	}
+
+	rows, err := s.pg.Query(
+		ctx,
+		fmt.Sprintf(
+			`SELECT date_trunc($3, "created_at" AT TIME ZONE $4) AT TIME ZONE $4 AS "start", "currency", COUNT(*),
+				SUM("value")
+			FROM "entries"
+			WHERE %s
+			GROUP BY "start", "currency"
+			ORDER BY "start" ASC`,
+			strings.Join(cond, " AND "),
+		),
+		append([]interface{}{user.ID, from, period, user.Location().String()}, tagsArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]*bot.PeriodSummary, 0, 32)
+	for rows.Next() {
+		item := &bot.PeriodSummary{}
+		if err := rows.Scan(&item.Start, &item.Currency, &item.Count, &item.Total); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+func (s *Repository) SumByMembers(
+	ctx context.Context, user *bot.User, from time.Time,
+) ([]*bot.MemberSummary, error) {
+	rows, err := s.pg.Query(
+		ctx,
+		`SELECT "m"."name", "e"."currency", COUNT(*), SUM("e"."value")
+		FROM "members" AS "m"
+		JOIN "entries" AS "e" ON "e"."user_id" = "m"."user_id" AND "e"."author_id" = "m"."telegram_id"
+		WHERE "m"."user_id" = $1 AND "e"."deleted_at" IS NULL AND "e"."created_at" > $2
+		GROUP BY "m"."id", "m"."name", "e"."currency"
+		ORDER BY SUM("e"."value") DESC`,
+		user.ID, from,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]*bot.MemberSummary, 0, 8)
+	for rows.Next() {
+		member := &bot.MemberSummary{}
+		if err := rows.Scan(&member.Name, &member.Currency, &member.Count, &member.Total); err != nil {
+			return nil, err
+		}
+		result = append(result, member)
+	}
+	return result, rows.Err()
+}
+
+func (s *Repository) GetSummary(
+	ctx context.Context, user *bot.User, from, to time.Time, limit int,
+) (*bot.Summary, error) {
+	result := &bot.Summary{From: from, To: to, Currency: user.Currency}
+	const cond = `"user_id" = $1 AND "deleted_at" IS NULL AND "currency" = $2
+		AND "created_at" >= $3 AND "created_at" < $4`
+	args := []interface{}{user.ID, user.Currency, from, to}
+
+	if err := s.pg.QueryRow(
+		ctx,
+		`SELECT COUNT(*), COALESCE(SUM("value"), 0) FROM "entries" WHERE `+cond,
+		args...,
+	).Scan(&result.Count, &result.Total); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pg.Query(
+		ctx,
+		`SELECT "tag", "currency", COUNT(*), SUM("value")
+		FROM "entries", UNNEST("tags") AS "tag"
+		WHERE `+cond+`
+		GROUP BY "tag", "currency"
+		ORDER BY SUM("value") DESC, "tag" ASC
+		LIMIT `+strconv.Itoa(limit),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		tag := &bot.TagSummary{}
+		if err := rows.Scan(&tag.Tag, &tag.Currency, &tag.Count, &tag.Total); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.Tags = append(result.Tags, tag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.pg.Query(
+		ctx,
+		`SELECT "id"::TEXT, "created_at", COALESCE("message_id", 0), COALESCE("reply_id", 0), "currency", "value", "comment", "tags"
+		FROM "entries"
+		WHERE `+cond+`
+		ORDER BY "value" DESC, "created_at" ASC
+		LIMIT `+strconv.Itoa(limit),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry := &bot.Entry{}
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.MessageID,
+			&entry.ReplyID,
+			&entry.Currency,
+			&entry.Value,
+			&entry.Comment,
+			&entry.Tags,
+		); err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	return result, rows.Err()
+}
+
 func (s *Repository) AddTag(ctx context.Context, user *bot.User, search string, tags []string) error {
 	_, err := s.pg.Exec(
 		ctx,
@@ -187,18 +976,75 @@ func (s *Repository) RemoveTag(ctx context.Context, user *bot.User, tags []strin
 	return tx.Commit(ctx)
 }
 
-func (s *Repository) ListTag(ctx context.Context, user *bot.User, search []string) ([]string, error) {
+func (s *Repository) MergeTags(ctx context.Context, user *bot.User, tags []string, into string) error {
+	// replace every tag from the list with the target one and drop duplicates keeping original order
+	_, err := s.pg.Exec(
+		ctx,
+		`UPDATE "entries" SET "tags" = ARRAY(
+			SELECT "tag" FROM (
+				SELECT CASE WHEN "t" = ANY($2::varchar[]) THEN $3::varchar ELSE "t" END AS "tag", MIN("n") AS "n"
+				FROM UNNEST("tags") WITH ORDINALITY AS "u" ("t", "n")
+				GROUP BY 1
+			) AS "r" ORDER BY "n" ASC
+		)
+		WHERE "user_id" = $1 AND "tags" && $2::varchar[]`,
+		user.ID, tags, into,
+	)
+	return err
+}
+
+func (s *Repository) ListTag(ctx context.Context, user *bot.User, search []string) ([]*bot.TagSummary, error) {
+	cond := []string{`"e"."user_id" = $1`, `"e"."deleted_at" IS NULL`}
+	tagsCond, tagsArgs := tagsCondition(search, 1)
+	if len(search) > 0 {
+		cond = append(cond, tagsCond)
+	}
+
+	// every entry is counted once for each tag and each of its parents
+	rows, err := s.pg.Query(
+		ctx,
+		fmt.Sprintf(
+			`SELECT "tag", "currency", COUNT(*), SUM("value") FROM (
+				SELECT DISTINCT "e"."id", "e"."currency", "e"."value", array_to_string("p"[1:"n"], '/') AS "tag"
+				FROM "entries" AS "e",
+					UNNEST("e"."tags") AS "t",
+					string_to_array("t", '/') AS "p",
+					generate_series(1, array_length("p", 1)) AS "n"
+				WHERE %s
+			) AS "s"
+			GROUP BY "tag", "currency"
+			ORDER BY "tag" ASC, "currency" ASC`,
+			strings.Join(cond, " AND "),
+		),
+		append([]interface{}{user.ID}, tagsArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := make([]*bot.TagSummary, 0, 32)
+	for rows.Next() {
+		tag := &bot.TagSummary{}
+		if err := rows.Scan(&tag.Tag, &tag.Currency, &tag.Count, &tag.Total); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (s *Repository) FrequentTags(ctx context.Context, user *bot.User, limit int) ([]string, error) {
 	rows, err := s.pg.Query(
 		ctx,
-		`SELECT DISTINCT UNNEST("tags") AS "tag"
-		FROM "entries" WHERE "user_id" = $1 AND $2 <@ "tags"
-		ORDER BY "tag" ASC`,
-		user.ID, search,
+		`SELECT UNNEST("tags") AS "tag" FROM "entries" WHERE "user_id" = $1 AND "deleted_at" IS NULL
+		GROUP BY "tag" ORDER BY COUNT(*) DESC, "tag" ASC LIMIT $2`,
+		user.ID, limit,
 	)
 	if err != nil {
 		return nil, err
 	}
-	tags := make([]string, 0, 32)
+	defer rows.Close()
+	tags := make([]string, 0, limit)
 	for rows.Next() {
 		var tag string
 		if err := rows.Scan(&tag); err != nil {
@@ -206,10 +1052,205 @@ func (s *Repository) ListTag(ctx context.Context, user *bot.User, search []strin
 		}
 		tags = append(tags, tag)
 	}
-	return tags, nil
+	return tags, rows.Err()
+}
+
+func (s *Repository) SaveRule(ctx context.Context, user *bot.User, rule *bot.Rule) (*bot.Rule, error) {
+	result := &bot.Rule{
+		Pattern: rule.Pattern,
+		Regexp:  rule.Regexp,
+		Tags:    rule.Tags[:],
+	}
+	err := s.pg.QueryRow(
+		ctx,
+		`INSERT INTO "rules" ("user_id", "pattern", "regexp", "tags")
+		VALUES ($1, $2, $3, $4)
+		RETURNING "id"::TEXT`,
+		user.ID, rule.Pattern, rule.Regexp, rule.Tags,
+	).Scan(&result.ID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Repository) ListRules(ctx context.Context, user *bot.User) ([]*bot.Rule, error) {
+	rows, err := s.pg.Query(
+		ctx,
+		`SELECT "id"::TEXT, "pattern", "regexp", "tags" FROM "rules" WHERE "user_id" = $1 ORDER BY "id" ASC`,
+		user.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rules := make([]*bot.Rule, 0, 8)
+	for rows.Next() {
+		rule := &bot.Rule{}
+		if err := rows.Scan(&rule.ID, &rule.Pattern, &rule.Regexp, &rule.Tags); err != nil {
+			return nil, err
+		}
+		if err := rule.Compile(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (s *Repository) DeleteRule(ctx context.Context, user *bot.User, id string) error {
+	tag, err := s.pg.Exec(ctx, `DELETE FROM "rules" WHERE "id" = $1 AND "user_id" = $2`, id, user.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return &bot.RuleNotFoundError{ID: id}
+	}
+	return nil
+}
+
+func (s *Repository) ApplyRule(ctx context.Context, user *bot.User, id string) (int64, error) {
+	rule := &bot.Rule{ID: id}
+	err := s.pg.QueryRow(
+		ctx,
+		`SELECT "pattern", "regexp", "tags" FROM "rules" WHERE "id" = $1 AND "user_id" = $2`,
+		id, user.ID,
+	).Scan(&rule.Pattern, &rule.Regexp, &rule.Tags)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, &bot.RuleNotFoundError{ID: id}
+		}
+		return 0, err
+	}
+	if err := rule.Compile(); err != nil {
+		return 0, err
+	}
+
+	// comments are matched by the same code as new entries, so rule tags existing and new entries alike,
+	// keywords are also prefiltered by database while regular expressions of postgres differ from ones of Go
+	cond := `"user_id" = $1 AND "deleted_at" IS NULL AND NOT "tags" @> $2 AND "id" > $3`
+	args := []interface{}{user.ID, rule.Tags, int64(0)}
+	if !rule.Regexp {
+		cond += ` AND strpos(lower("comment"), lower($4)) > 0`
+		args = append(args, rule.Pattern)
+	}
+	var updated int64
+	for {
+		rows, err := s.pg.Query(
+			ctx,
+			`SELECT "id", "comment" FROM "entries" WHERE `+cond+` ORDER BY "id" LIMIT `+strconv.Itoa(applyRuleChunk),
+			args...,
+		)
+		if err != nil {
+			return updated, err
+		}
+		n := 0
+		ids := make([]int64, 0, applyRuleChunk)
+		for rows.Next() {
+			var entryID int64
+			var comment string
+			if err := rows.Scan(&entryID, &comment); err != nil {
+				rows.Close()
+				return updated, err
+			}
+			n++
+			args[2] = entryID
+			if rule.Match(comment) {
+				ids = append(ids, entryID)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return updated, err
+		}
+		if len(ids) > 0 {
+			// missing tags are appended in order of rule, entries changed meanwhile keep their tags
+			tag, err := s.pg.Exec(
+				ctx,
+				`UPDATE "entries" SET "tags" = "tags" || ARRAY(
+					SELECT "t" FROM UNNEST($1::VARCHAR[]) WITH ORDINALITY AS "r"("t", "i")
+					WHERE NOT "t" = ANY("entries"."tags") ORDER BY "i"
+				)
+				WHERE "id" = ANY($2) AND "deleted_at" IS NULL AND NOT "tags" @> $1`,
+				rule.Tags, ids,
+			)
+			if err != nil {
+				return updated, err
+			}
+			updated += tag.RowsAffected()
+		}
+		if n < applyRuleChunk {
+			return updated, nil
+		}
+	}
 }
 
-func New(url string) (bot.Repository, error) {
+// entriesPage selects page of entries matching condition from most recent ones and total number of them,
+// total is counted separately so it is known even for pages past the last one
+func (s *Repository) entriesPage(
+	ctx context.Context, cond string, args []interface{}, offset, limit int,
+) ([]*bot.Entry, int, error) {
+	var total int
+	if err := s.pg.QueryRow(
+		ctx, `SELECT COUNT(*) FROM "entries" WHERE `+cond, args...,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.pg.Query(
+		ctx,
+		fmt.Sprintf(
+			`SELECT "id"::TEXT, "created_at", COALESCE("message_id", 0), COALESCE("reply_id", 0), "currency", "value", "comment", "tags"
+			FROM "entries" WHERE %s ORDER BY "created_at" DESC OFFSET %d LIMIT %d`,
+			cond,
+			offset,
+			limit,
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result := make([]*bot.Entry, 0, limit)
+	for rows.Next() {
+		entry := &bot.Entry{}
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.MessageID,
+			&entry.ReplyID,
+			&entry.Currency,
+			&entry.Value,
+			&entry.Comment,
+			&entry.Tags,
+		); err != nil {
+			return nil, 0, err
+		}
+		result = append(result, entry)
+	}
+	return result, total, rows.Err()
+}
+
+// tagsCondition builds condition for entries having each of tags or any of its subtags,
+// placeholders are numbered after n
+func tagsCondition(tags []string, n int) (string, []interface{}) {
+	cond := make([]string, 0, len(tags))
+	args := make([]interface{}, 0, len(tags))
+	for _, tag := range tags {
+		n++
+		cond = append(cond, fmt.Sprintf(
+			`EXISTS (SELECT 1 FROM UNNEST("tags") AS "t" WHERE "t" = $%[1]d OR "t" LIKE $%[1]d || '/%%')`,
+			n,
+		))
+		args = append(args, tag)
+	}
+	return strings.Join(cond, " AND "), args
+}
+
+// New connects to database, metrics of connection pool are registered with registerer
+func New(url string, logger *logrus.Logger, registerer prometheus.Registerer) (bot.Repository, error) {
 	config, err := pgxpool.ParseConfig(url)
 	if err != nil {
 		return nil, err
@@ -218,6 +1259,12 @@ func New(url string) (bot.Repository, error) {
 	config.MaxConns = 2
 	config.MaxConnLifetime = 5 * time.Minute
 	config.LazyConnect = true
+	config.ConnConfig.Logger = &queryLogger{logger: logger}
+	// every query is logged at info level of pgx, so it is shown only when debugging
+	config.ConnConfig.LogLevel = pgx.LogLevelWarn
+	if logger.IsLevelEnabled(logrus.DebugLevel) {
+		config.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
 
 	pool, err := pgxpool.ConnectConfig(context.Background(), config)
 	if err != nil {
@@ -225,9 +1272,15 @@ func New(url string) (bot.Repository, error) {
 	}
 	ping, err := pool.Acquire(context.Background())
 	if err != nil {
+		pool.Close()
 		return nil, err
 	}
-	defer ping.Release()
+	// pool waits for acquired connections when it is closed
+	ping.Release()
 
+	if err := registerer.Register(newPoolCollector(pool)); err != nil {
+		pool.Close()
+		return nil, err
+	}
 	return &Repository{pg: pool}, nil
 }
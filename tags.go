@@ -0,0 +1,49 @@
+package accounting_bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const tagSeparator = "/"
+
+// FormatTagTree renders tag summaries as indented tree with subtotals, children follow their parent
+func FormatTagTree(tags []*TagSummary) string {
+	tags = sortTagTree(tags)
+	b := strings.Builder{}
+	for i := 0; i < len(tags); {
+		tag := tags[i].Tag
+		count := 0
+		totals := make([]string, 0, 1)
+		for ; i < len(tags) && tags[i].Tag == tag; i++ {
+			count += tags[i].Count
+			totals = append(totals, fmt.Sprintf("%.2f%s", tags[i].Total, tags[i].Currency))
+		}
+		depth := strings.Count(tag, tagSeparator)
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(tag)
+		b.WriteString(fmt.Sprintf(" — %s (%d)\n", strings.Join(totals, ", "), count)) // TODO: i18n
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// sortTagTree sorts tags by parts of their path, so "#food/cafe" follows "#food" and precedes "#foodie"
+// regardless of collation of storage
+func sortTagTree(tags []*TagSummary) []*TagSummary {
+	sorted := make([]*TagSummary, len(tags))
+	copy(sorted, tags)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := strings.Split(sorted[i].Tag, tagSeparator), strings.Split(sorted[j].Tag, tagSeparator)
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return sorted[i].Currency < sorted[j].Currency
+	})
+	return sorted
+}
@@ -0,0 +1,26 @@
+package accounting_bot
+
+import "testing"
+
+func TestFormatTagTree(t *testing.T) {
+	// order of collations which ignore punctuation
+	tags := []*TagSummary{
+		{Tag: "#food", Currency: "USD", Count: 3, Total: 30},
+		{Tag: "#food", Currency: "EUR", Count: 1, Total: 5},
+		{Tag: "#foodie", Currency: "USD", Count: 1, Total: 7},
+		{Tag: "#food/cafe", Currency: "USD", Count: 2, Total: 20},
+		{Tag: "#food/cafe/coffee", Currency: "USD", Count: 1, Total: 4},
+		{Tag: "#car", Currency: "USD", Count: 1, Total: 50},
+	}
+	want := "#car — 50.00USD (1)\n" +
+		"#food — 5.00EUR, 30.00USD (4)\n" +
+		"  #food/cafe — 20.00USD (2)\n" +
+		"    #food/cafe/coffee — 4.00USD (1)\n" +
+		"#foodie — 7.00USD (1)"
+	if s := FormatTagTree(tags); s != want {
+		t.Errorf("got\n%s\nwant\n%s", s, want)
+	}
+	if tags[0].Tag != "#food" || tags[1].Currency != "EUR" {
+		t.Error("tags are sorted in place")
+	}
+}